@@ -0,0 +1,86 @@
+// This file provides functions for composing and inverting mesh warps so
+// that chains of warps can be applied with a single resampling of the image.
+
+package xmorph
+
+import "fmt"
+
+// sampleMeshPoints returns the points of an nx×ny mesh that describes the same
+// shape as m.  If the dimensions already match, m's own points are returned.
+func sampleMeshPoints(m *Mesh, nx, ny int) ([][]Point, error) {
+	if nx < 4 || ny < 4 {
+		return nil, fmt.Errorf("mesh must be at least 4x4 (requested %dx%d)", nx, ny)
+	}
+	if nx == m.NX && ny == m.NY {
+		return m.Points(), nil
+	}
+	return resamplePoints(m.Points(), nx, ny), nil
+}
+
+// snapEdges copies the boundary coordinate of each edge point in ref to the
+// corresponding point in pts so that mapped edges remain exactly on the image
+// boundary, as libmorph requires.
+func snapEdges(pts, ref [][]Point) {
+	ny, nx := len(pts), len(pts[0])
+	for c := 0; c < nx; c++ {
+		pts[0][c].Y = ref[0][c].Y
+		pts[ny-1][c].Y = ref[ny-1][c].Y
+	}
+	for r := 0; r < ny; r++ {
+		pts[r][0].X = ref[r][0].X
+		pts[r][nx-1].X = ref[r][nx-1].X
+	}
+}
+
+// ComposeWarps returns a single source/destination mesh pair that
+// approximates warping an image from src1 to dst1 and then warping the result
+// from src2 to dst2.  The first pair of meshes and the second pair of meshes
+// must each be compatible, but the two pairs need not have the same
+// dimensions.  The returned meshes are nx×ny; their points are placed on the
+// first warp's source mesh (resampled if necessary), and each is mapped
+// exactly through both warps.  Between mesh points the composite is
+// approximate, so denser meshes reproduce the chain more faithfully.
+func ComposeWarps(src1, dst1, src2, dst2 *Mesh, nx, ny int) (*Mesh, *Mesh, error) {
+	mm1, err := NewMeshMapping(src1, dst1)
+	if err != nil {
+		return nil, nil, err
+	}
+	mm2, err := NewMeshMapping(src2, dst2)
+	if err != nil {
+		return nil, nil, err
+	}
+	sp, err := sampleMeshPoints(src1, nx, ny)
+	if err != nil {
+		return nil, nil, err
+	}
+	dp := make([][]Point, ny)
+	for r, row := range sp {
+		dp[r] = mm2.MapPoints(mm1.MapPoints(row))
+	}
+	snapEdges(dp, sp)
+	return MeshFromPoints(sp), MeshFromPoints(dp), nil
+}
+
+// InvertWarp returns a source/destination mesh pair that approximately undoes
+// the warp from src to dst.  Simply swapping src and dst also undoes a warp at
+// the mesh points but not, in general, between them, because libmorph's
+// splines interpolate the two meshes differently.  InvertWarp instead places
+// the points of an nx×ny source mesh on dst (resampled if necessary) and maps
+// each of them exactly through the inverse warp.  Denser meshes produce a
+// more accurate inverse.
+func InvertWarp(src, dst *Mesh, nx, ny int) (*Mesh, *Mesh, error) {
+	mm, err := NewMeshMapping(src, dst)
+	if err != nil {
+		return nil, nil, err
+	}
+	sp, err := sampleMeshPoints(dst, nx, ny)
+	if err != nil {
+		return nil, nil, err
+	}
+	dp := make([][]Point, ny)
+	for r, row := range sp {
+		dp[r] = mm.InverseMapPoints(row)
+	}
+	snapEdges(dp, sp)
+	return MeshFromPoints(sp), MeshFromPoints(dp), nil
+}
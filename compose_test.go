@@ -0,0 +1,130 @@
+// The functions defined in this file ensure the xmorph package's warp
+// composition and inversion operations work as expected.
+
+package xmorph
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// TestComposeWarpsIdentity ensures that composing a warp with an identity
+// warp reproduces the original warp.
+func TestComposeWarpsIdentity(t *testing.T) {
+	const nx, ny, wd, ht = 6, 5, 120, 90
+	rng := rand.New(rand.NewSource(38))
+	src := NewRegularMesh(nx, ny, wd, ht)
+	defer src.Free()
+	dst := jaggedMesh(rng, nx, ny, wd, ht, 0.3)
+	defer dst.Free()
+	id := NewRegularMesh(4, 4, wd, ht)
+	defer id.Free()
+	cs, cd, err := ComposeWarps(src, dst, id, id, nx, ny)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cs.Free()
+	defer cd.Free()
+	for r := 0; r < ny; r++ {
+		for c := 0; c < nx; c++ {
+			if p, q := cs.Get(c, r), src.Get(c, r); !p.Eq(q, 1e-9) {
+				t.Fatalf("expected source point %v but saw %v", q, p)
+			}
+			if p, q := cd.Get(c, r), dst.Get(c, r); !p.Eq(q, 1e-6) {
+				t.Fatalf("expected destination point %v but saw %v", q, p)
+			}
+		}
+	}
+}
+
+// TestComposeWarps ensures that the points of a composed mesh pair follow a
+// chain of two warps and that edges remain on the image boundary.
+func TestComposeWarps(t *testing.T) {
+	const wd, ht = 150, 100
+	rng := rand.New(rand.NewSource(380))
+	src1 := NewRegularMesh(5, 5, wd, ht)
+	defer src1.Free()
+	dst1 := jaggedMesh(rng, 5, 5, wd, ht, 0.25)
+	defer dst1.Free()
+	src2 := NewRegularMesh(7, 6, wd, ht)
+	defer src2.Free()
+	dst2 := jaggedMesh(rng, 7, 6, wd, ht, 0.25)
+	defer dst2.Free()
+	cs, cd, err := ComposeWarps(src1, dst1, src2, dst2, 9, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cs.Free()
+	defer cd.Free()
+	if cs.NX != 9 || cs.NY != 8 || cd.NX != 9 || cd.NY != 8 {
+		t.Fatalf("expected 9x8 meshes but saw %dx%d and %dx%d", cs.NX, cs.NY, cd.NX, cd.NY)
+	}
+	if rep := cd.Validate(wd, ht); len(rep.EdgePoints) > 0 {
+		t.Fatalf("expected all edge points to lie on the boundary but saw %v", rep.EdgePoints)
+	}
+	for r := 1; r < cs.NY-1; r++ {
+		for c := 1; c < cs.NX-1; c++ {
+			p := cs.Get(c, r)
+			want := MapPoint(src2, dst2, MapPoint(src1, dst1, p))
+			if got := cd.Get(c, r); !got.Eq(want, 1e-6) {
+				t.Fatalf("expected %v to map to %v but saw %v", p, want, got)
+			}
+		}
+	}
+
+	// Incompatible meshes should be rejected.
+	if _, _, err := ComposeWarps(src1, dst2, src2, dst2, 9, 8); err == nil {
+		t.Fatal("expected incompatible meshes to be rejected")
+	}
+	if _, _, err := ComposeWarps(src1, dst1, src2, dst2, 3, 8); err == nil {
+		t.Fatal("expected a too-small mesh to be rejected")
+	}
+}
+
+// TestInvertWarp ensures that an inverted warp approximately undoes the
+// original warp everywhere and that it does so more accurately than simply
+// swapping the source and destination meshes.
+func TestInvertWarp(t *testing.T) {
+	const nx, ny, wd, ht = 5, 5, 160, 120
+	rng := rand.New(rand.NewSource(381))
+	src := NewRegularMesh(nx, ny, wd, ht)
+	defer src.Free()
+	dst := jaggedMesh(rng, nx, ny, wd, ht, 0.3)
+	defer dst.Free()
+	is, id, err := InvertWarp(src, dst, 4*nx, 4*ny)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer is.Free()
+	defer id.Free()
+
+	// Measure the round-trip error of both the inverted warp and the
+	// swapped meshes.
+	fwd, err := NewMeshMapping(src, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inv, err := NewMeshMapping(is, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	swap, err := NewMeshMapping(dst, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	invErr, swapErr := 0.0, 0.0
+	for i := 0; i < 500; i++ {
+		p := Point{X: rng.Float64() * (wd - 1), Y: rng.Float64() * (ht - 1)}
+		q := fwd.Map(p)
+		a, b := inv.Map(q), swap.Map(q)
+		invErr = math.Max(invErr, math.Hypot(a.X-p.X, a.Y-p.Y))
+		swapErr = math.Max(swapErr, math.Hypot(b.X-p.X, b.Y-p.Y))
+	}
+	if invErr > 0.5 {
+		t.Fatalf("expected the inverted warp to undo the original to within 0.5 pixels but saw an error of %.3g", invErr)
+	}
+	if invErr >= swapErr {
+		t.Fatalf("expected the inverted warp (error %.3g) to be more accurate than swapping meshes (error %.3g)", invErr, swapErr)
+	}
+}
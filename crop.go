@@ -0,0 +1,267 @@
+// This file provides functions for cropping and padding meshes, optionally
+// together with the images to which they correspond.
+
+package xmorph
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// Insets specify the number of pixels to add to each side of an image.
+type Insets struct {
+	Top, Left, Bottom, Right int
+}
+
+// transposeGrid swaps the rows and columns of a mesh's points and labels and
+// swaps each point's x and y coordinates so that row operations can be
+// implemented in terms of column operations.
+func transposeGrid(pts [][]Point, labels [][]int) ([][]Point, [][]int) {
+	ny, nx := len(pts), len(pts[0])
+	tp := make([][]Point, nx)
+	tl := make([][]int, nx)
+	for c := range tp {
+		tp[c] = make([]Point, ny)
+		tl[c] = make([]int, ny)
+		for r := range tp[c] {
+			tp[c][r] = Point{X: pts[r][c].Y, Y: pts[r][c].X}
+			tl[c][r] = labels[r][c]
+		}
+	}
+	return tp, tl
+}
+
+// meshLabels returns all of a mesh's labels, indexed [row][column].
+func (m *Mesh) meshLabels() [][]int {
+	labels := make([][]int, m.NY)
+	for r := range labels {
+		labels[r] = make([]int, m.NX)
+		for c := range labels[r] {
+			labels[r][c] = m.GetLabel(c, r)
+		}
+	}
+	return labels
+}
+
+// meshFromGrid creates a mesh from a 2-D slice of points and labels.
+func meshFromGrid(pts [][]Point, labels [][]int) *Mesh {
+	m := MeshFromPoints(pts)
+	for r, row := range labels {
+		for c, lbl := range row {
+			if lbl != 0 {
+				m.SetLabel(c, r, lbl)
+			}
+		}
+	}
+	return m
+}
+
+// cropColumns crops a mesh's points horizontally to the range [0, hi].  Each
+// row is cut where it crosses x = 0 and x = hi, and the cut points form new
+// edge columns.  Columns that do not lie entirely within (0, hi) are
+// deleted.
+func cropColumns(pts [][]Point, labels [][]int, hi float64) ([][]Point, [][]int, error) {
+	ny, nx := len(pts), len(pts[0])
+
+	// Determine which columns lie entirely within the new bounds.
+	keep := make([]bool, nx)
+	for c := range keep {
+		keep[c] = true
+		for r := 0; r < ny; r++ {
+			if x := pts[r][c].X; x <= 0.0 || x >= hi {
+				keep[c] = false
+				break
+			}
+		}
+	}
+
+	// Construct the new rows.
+	outPts := make([][]Point, ny)
+	outLabels := make([][]int, ny)
+	for r, row := range pts {
+		// Find where the row crosses each boundary.
+		lo, up := -1, -1
+		for c := 1; c < nx; c++ {
+			if lo == -1 && row[c-1].X <= 0.0 && row[c].X > 0.0 {
+				lo = c - 1
+			}
+			if row[c-1].X < hi && row[c].X >= hi {
+				up = c - 1
+			}
+		}
+		if lo == -1 || up == -1 {
+			return nil, nil, fmt.Errorf("crop region must lie within the mesh")
+		}
+		cut := func(c int, x float64) Point {
+			a, b := row[c], row[c+1]
+			t := (x - a.X) / (b.X - a.X)
+			return Point{X: x, Y: a.Y + t*(b.Y-a.Y)}
+		}
+
+		// Assemble the row from the two cut points and the kept
+		// columns.
+		outPts[r] = append(outPts[r], cut(lo, 0.0))
+		outLabels[r] = append(outLabels[r], 0)
+		for c, k := range keep {
+			if k {
+				outPts[r] = append(outPts[r], row[c])
+				outLabels[r] = append(outLabels[r], labels[r][c])
+			}
+		}
+		outPts[r] = append(outPts[r], cut(up, hi))
+		outLabels[r] = append(outLabels[r], 0)
+	}
+	if n := len(outPts[0]); n < 4 {
+		return nil, nil, fmt.Errorf("cropped mesh would have only %d columns (at least 4 are required)", n)
+	}
+	return outPts, outLabels, nil
+}
+
+// padColumns adds a new edge column left pixels to the left of a mesh's
+// first column and another right pixels to the right of its last column.
+// The caller must already have shifted the points to the right by left
+// pixels.  No column is added for an inset of zero.
+func padColumns(pts [][]Point, labels [][]int, left, right int) ([][]Point, [][]int) {
+	outPts := make([][]Point, len(pts))
+	outLabels := make([][]int, len(pts))
+	for r, row := range pts {
+		if left > 0 {
+			outPts[r] = append(outPts[r], Point{X: row[0].X - float64(left), Y: row[0].Y})
+			outLabels[r] = append(outLabels[r], 0)
+		}
+		outPts[r] = append(outPts[r], row...)
+		outLabels[r] = append(outLabels[r], labels[r]...)
+		if right > 0 {
+			last := row[len(row)-1]
+			outPts[r] = append(outPts[r], Point{X: last.X + float64(right), Y: last.Y})
+			outLabels[r] = append(outLabels[r], 0)
+		}
+	}
+	return outPts, outLabels
+}
+
+// Crop returns a new mesh that corresponds to the rectangle rect of m's
+// image.  Mesh coordinates are shifted so that rect.Min becomes the origin.
+// New edge rows and columns are inserted where the mesh's rows and columns
+// cross the rectangle's boundary, and rows and columns that do not lie
+// entirely within the rectangle are deleted, so the result's edges lie on
+// the boundary of the cropped image, as libmorph requires.  Labels of
+// surviving points are preserved.  Crop returns an error if rect does not
+// lie within the mesh or if too few rows or columns would remain.
+func (m *Mesh) Crop(rect image.Rectangle) (*Mesh, error) {
+	if rect.Dx() < 2 || rect.Dy() < 2 {
+		return nil, fmt.Errorf("crop rectangle %v is too small", rect)
+	}
+	pts := m.Points()
+	off := Point{X: float64(rect.Min.X), Y: float64(rect.Min.Y)}
+	for _, row := range pts {
+		for c := range row {
+			row[c] = row[c].Sub(off)
+		}
+	}
+	pts, labels, err := cropColumns(pts, m.meshLabels(), float64(rect.Dx()-1))
+	if err != nil {
+		return nil, err
+	}
+	pts, labels = transposeGrid(pts, labels)
+	pts, labels, err = cropColumns(pts, labels, float64(rect.Dy()-1))
+	if err != nil {
+		return nil, err
+	}
+	pts, labels = transposeGrid(pts, labels)
+	return meshFromGrid(pts, labels), nil
+}
+
+// Pad returns a new mesh that corresponds to m's image with extra pixels
+// added to each side.  Mesh coordinates are shifted by the top and left
+// insets, and a new edge row or column is added on each side with a
+// nonzero inset so that the result's edges lie on the boundary of the padded
+// image, as libmorph requires.  Labels are preserved.  Pad returns an error
+// if any inset is negative.
+func (m *Mesh) Pad(in Insets) (*Mesh, error) {
+	if in.Top < 0 || in.Left < 0 || in.Bottom < 0 || in.Right < 0 {
+		return nil, fmt.Errorf("insets %+v must be non-negative", in)
+	}
+	pts := m.Points()
+	off := Point{X: float64(in.Left), Y: float64(in.Top)}
+	for _, row := range pts {
+		for c := range row {
+			row[c] = row[c].Add(off)
+		}
+	}
+	pts, labels := padColumns(pts, m.meshLabels(), in.Left, in.Right)
+	pts, labels = transposeGrid(pts, labels)
+	pts, labels = padColumns(pts, labels, in.Top, in.Bottom)
+	pts, labels = transposeGrid(pts, labels)
+	return meshFromGrid(pts, labels), nil
+}
+
+// CropImageAndMesh crops both an image and its mesh to a rectangle, given in
+// the image's coordinate system.  When possible, the returned image shares
+// pixels with the original image.  The returned image's bounds begin at
+// rect.Min, but, as always, mesh coordinates are relative to the image's
+// upper-left corner.
+func CropImageAndMesh(img image.Image, m *Mesh, rect image.Rectangle) (image.Image, *Mesh, error) {
+	bnds := img.Bounds()
+	if !rect.In(bnds) {
+		return nil, nil, fmt.Errorf("crop rectangle %v does not lie within the image bounds %v", rect, bnds)
+	}
+	cm, err := m.Crop(rect.Sub(bnds.Min))
+	if err != nil {
+		return nil, nil, err
+	}
+	type subImager interface {
+		SubImage(r image.Rectangle) image.Image
+	}
+	si, ok := img.(subImager)
+	if !ok {
+		si = convertToNRGBA(img)
+	}
+	return si.SubImage(rect), cm, nil
+}
+
+// newImageLike returns a new, blank image with given bounds and the same
+// type as a given image, if that type is one of the image package's
+// standard types, or an NRGBA image otherwise.
+func newImageLike(img image.Image, r image.Rectangle) draw.Image {
+	switch img.(type) {
+	case *image.Alpha:
+		return image.NewAlpha(r)
+	case *image.Alpha16:
+		return image.NewAlpha16(r)
+	case *image.CMYK:
+		return image.NewCMYK(r)
+	case *image.Gray:
+		return image.NewGray(r)
+	case *image.Gray16:
+		return image.NewGray16(r)
+	case *image.NRGBA64:
+		return image.NewNRGBA64(r)
+	case *image.RGBA:
+		return image.NewRGBA(r)
+	case *image.RGBA64:
+		return image.NewRGBA64(r)
+	default:
+		return image.NewNRGBA(r)
+	}
+}
+
+// PadImageAndMesh pads both an image and its mesh, filling the new pixels
+// with a given color.  The returned image has the same type as the original
+// when that is one of the image package's standard types and is an NRGBA
+// image otherwise.  Its bounds begin at the origin.
+func PadImageAndMesh(img image.Image, m *Mesh, in Insets, fill color.Color) (image.Image, *Mesh, error) {
+	pm, err := m.Pad(in)
+	if err != nil {
+		return nil, nil, err
+	}
+	bnds := img.Bounds()
+	r := image.Rect(0, 0, bnds.Dx()+in.Left+in.Right, bnds.Dy()+in.Top+in.Bottom)
+	out := newImageLike(img, r)
+	draw.Draw(out, r, image.NewUniform(fill), image.Point{}, draw.Src)
+	dr := image.Rect(in.Left, in.Top, in.Left+bnds.Dx(), in.Top+bnds.Dy())
+	draw.Draw(out, dr, img, bnds.Min, draw.Src)
+	return out, pm, nil
+}
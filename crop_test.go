@@ -0,0 +1,184 @@
+// The functions defined in this file ensure the xmorph package's cropping
+// and padding operations work as expected.
+
+package xmorph
+
+import (
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+)
+
+// TestCropIdentity ensures that cropping a mesh to its full image leaves it
+// unchanged.
+func TestCropIdentity(t *testing.T) {
+	const nx, ny, wd, ht = 6, 5, 120, 100
+	rng := rand.New(rand.NewSource(44))
+	m := jaggedMesh(rng, nx, ny, wd, ht, 0.3)
+	defer m.Free()
+	cm, err := m.Crop(image.Rect(0, 0, wd, ht))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cm.Free()
+	if cm.NX != nx || cm.NY != ny {
+		t.Fatalf("expected a %dx%d mesh but saw %dx%d", nx, ny, cm.NX, cm.NY)
+	}
+	if d, _ := MaxDisplacement(m, cm); d > 1e-9 {
+		t.Fatalf("expected an unchanged mesh but saw a displacement of %v", d)
+	}
+}
+
+// TestCrop ensures that cropping inserts edge lines at the crop boundary,
+// deletes lines outside it, and preserves labels.
+func TestCrop(t *testing.T) {
+	m := NewRegularMesh(5, 5, 401, 401)
+	defer m.Free()
+	m.SetLabel(2, 2, 7)
+	cm, err := m.Crop(image.Rect(50, 50, 351, 301))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cm.Free()
+	xs := []float64{0, 50, 150, 250, 300}
+	ys := []float64{0, 50, 150, 250}
+	if cm.NX != len(xs) || cm.NY != len(ys) {
+		t.Fatalf("expected a %dx%d mesh but saw %dx%d", len(xs), len(ys), cm.NX, cm.NY)
+	}
+	for r, y := range ys {
+		for c, x := range xs {
+			if p := cm.Get(c, r); !p.Eq(Point{X: x, Y: y}, 1e-9) {
+				t.Fatalf("expected (%v, %v) at (%d, %d) but saw %v", x, y, c, r, p)
+			}
+		}
+	}
+	if lbl := cm.GetLabel(2, 2); lbl != 7 {
+		t.Fatalf("expected label 7 to be preserved but saw %d", lbl)
+	}
+	if rep := cm.Validate(301, 251); !rep.OK() {
+		t.Fatalf("expected a valid cropped mesh but saw %+v", rep)
+	}
+
+	// A jagged mesh should also crop to a valid mesh.
+	rng := rand.New(rand.NewSource(440))
+	jm := jaggedMesh(rng, 12, 10, 400, 300, 0.3)
+	defer jm.Free()
+	jc, err := jm.Crop(image.Rect(37, 61, 290, 250))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jc.Free()
+	if rep := jc.Validate(253, 189); !rep.OK() {
+		t.Fatalf("expected a valid cropped mesh but saw %+v", rep)
+	}
+
+	// Invalid regions should be rejected.
+	for _, r := range []image.Rectangle{
+		image.Rect(-10, 0, 100, 100),
+		image.Rect(0, 0, 500, 100),
+		image.Rect(10, 10, 11, 50),
+		image.Rect(10, 10, 60, 60),
+	} {
+		if _, err := m.Crop(r); err == nil {
+			t.Fatalf("expected cropping to %v to fail", r)
+		}
+	}
+}
+
+// TestPad ensures that padding shifts a mesh and adds edge lines only on
+// padded sides.
+func TestPad(t *testing.T) {
+	m := NewRegularMesh(4, 4, 100, 100)
+	defer m.Free()
+	m.SetLabel(1, 1, 3)
+	pm, err := m.Pad(Insets{Top: 10, Left: 20, Right: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pm.Free()
+	if pm.NX != 6 || pm.NY != 5 {
+		t.Fatalf("expected a 6x5 mesh but saw %dx%d", pm.NX, pm.NY)
+	}
+	if rep := pm.Validate(125, 110); !rep.OK() {
+		t.Fatalf("expected a valid padded mesh but saw %+v", rep)
+	}
+	if p := pm.Get(2, 2); !p.Eq(Point{X: 53, Y: 43}, 1e-9) {
+		t.Fatalf("expected (53, 43) but saw %v", p)
+	}
+	if lbl := pm.GetLabel(2, 2); lbl != 3 {
+		t.Fatalf("expected label 3 to be preserved but saw %d", lbl)
+	}
+	if _, err := m.Pad(Insets{Top: -1}); err == nil {
+		t.Fatal("expected negative insets to be rejected")
+	}
+
+	// Cropping away the padding should restore the original mesh.
+	cm, err := pm.Crop(image.Rect(20, 10, 120, 110))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cm.Free()
+	if d, err := MaxDisplacement(m, cm); err != nil || d > 1e-9 {
+		t.Fatalf("expected to recover the original mesh but saw a displacement of %v (%v)", d, err)
+	}
+}
+
+// TestCropPadImageAndMesh ensures that images and meshes are cropped and
+// padded consistently.
+func TestCropPadImageAndMesh(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 64, 48))
+	for y := 0; y < 48; y++ {
+		for x := 0; x < 64; x++ {
+			img.SetGray(x, y, color.Gray{Y: uint8(x + y)})
+		}
+	}
+	m := NewRegularMesh(5, 5, 64, 48)
+	defer m.Free()
+
+	// Crop.
+	ci, cm, err := CropImageAndMesh(img, m, image.Rect(8, 6, 56, 42))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cm.Free()
+	g, ok := ci.(*image.Gray)
+	if !ok {
+		t.Fatalf("expected an *image.Gray but saw %T", ci)
+	}
+	if b := g.Bounds(); b.Dx() != 48 || b.Dy() != 36 {
+		t.Fatalf("expected a 48x36 image but saw %v", b)
+	}
+	if c := g.GrayAt(8, 6).Y; c != 14 {
+		t.Fatalf("expected pixel value 14 but saw %d", c)
+	}
+	if rep := cm.Validate(48, 36); !rep.OK() {
+		t.Fatalf("expected a valid cropped mesh but saw %+v", rep)
+	}
+	if _, _, err := CropImageAndMesh(img, m, image.Rect(8, 6, 80, 42)); err == nil {
+		t.Fatal("expected a crop rectangle outside the image to be rejected")
+	}
+
+	// Pad.
+	pi, pm, err := PadImageAndMesh(img, m, Insets{Top: 2, Left: 3, Bottom: 4, Right: 5}, color.Gray{Y: 255})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pm.Free()
+	g, ok = pi.(*image.Gray)
+	if !ok {
+		t.Fatalf("expected an *image.Gray but saw %T", pi)
+	}
+	if b := g.Bounds(); b != image.Rect(0, 0, 72, 54) {
+		t.Fatalf("expected bounds (0,0)-(72,54) but saw %v", b)
+	}
+	if c := g.GrayAt(0, 0).Y; c != 255 {
+		t.Fatalf("expected fill value 255 but saw %d", c)
+	}
+	if c := g.GrayAt(13, 12).Y; c != 20 {
+		t.Fatalf("expected pixel value 20 but saw %d", c)
+	}
+	if rep := pm.Validate(72, 54); !rep.OK() {
+		t.Fatalf("expected a valid padded mesh but saw %+v", rep)
+	}
+}
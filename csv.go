@@ -0,0 +1,133 @@
+// This file provides functions for reading and writing meshes as CSV files.
+
+package xmorph
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// csvHeader is the header row of a mesh CSV file.
+var csvHeader = []string{"row", "col", "x", "y", "label"}
+
+// WriteCSV outputs a mesh as a CSV file with columns row, col, x, y, and
+// label.  The first line of the file is a header row naming these columns.
+// Points are written in row-major order.
+func (m *Mesh) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+	for r, row := range m.Points() {
+		for c, pt := range row {
+			rec := []string{
+				strconv.Itoa(r),
+				strconv.Itoa(c),
+				strconv.FormatFloat(pt.X, 'g', -1, 64),
+				strconv.FormatFloat(pt.Y, 'g', -1, 64),
+				strconv.Itoa(m.GetLabel(c, r)),
+			}
+			if err := cw.Write(rec); err != nil {
+				return err
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ReadMeshCSV reads a mesh from a CSV file with columns row, col, x, y, and
+// (optionally) label, as written by WriteCSV.  An initial header row is
+// optional.  Points may appear in any order, but every (row, col) pair in the
+// mesh must appear exactly once.
+func ReadMeshCSV(r io.Reader) (*Mesh, error) {
+	// Read all records into memory.
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	cr.Comment = '#'
+	recs, err := cr.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mesh CSV data (%w)", err)
+	}
+	if len(recs) > 0 && strings.EqualFold(strings.TrimSpace(recs[0][0]), csvHeader[0]) {
+		recs = recs[1:]
+	}
+
+	// Parse each record.
+	type csvPoint struct {
+		r, c  int
+		pt    Point
+		label int
+	}
+	cps := make([]csvPoint, len(recs))
+	nx, ny := 0, 0
+	for i, rec := range recs {
+		if len(rec) != 4 && len(rec) != 5 {
+			return nil, fmt.Errorf("CSV record %d contains %d fields (expected 4 or 5)", i+1, len(rec))
+		}
+		var cp csvPoint
+		if cp.r, err = strconv.Atoi(strings.TrimSpace(rec[0])); err != nil {
+			return nil, fmt.Errorf("failed to parse CSV record %d's row %q (%w)", i+1, rec[0], err)
+		}
+		if cp.c, err = strconv.Atoi(strings.TrimSpace(rec[1])); err != nil {
+			return nil, fmt.Errorf("failed to parse CSV record %d's column %q (%w)", i+1, rec[1], err)
+		}
+		if cp.pt.X, err = strconv.ParseFloat(strings.TrimSpace(rec[2]), 64); err != nil {
+			return nil, fmt.Errorf("failed to parse CSV record %d's x coordinate %q (%w)", i+1, rec[2], err)
+		}
+		if cp.pt.Y, err = strconv.ParseFloat(strings.TrimSpace(rec[3]), 64); err != nil {
+			return nil, fmt.Errorf("failed to parse CSV record %d's y coordinate %q (%w)", i+1, rec[3], err)
+		}
+		if len(rec) == 5 {
+			if cp.label, err = strconv.Atoi(strings.TrimSpace(rec[4])); err != nil {
+				return nil, fmt.Errorf("failed to parse CSV record %d's label %q (%w)", i+1, rec[4], err)
+			}
+		}
+		if cp.r < 0 || cp.c < 0 || cp.r >= len(recs) || cp.c >= len(recs) {
+			return nil, fmt.Errorf("CSV record %d specifies an out-of-range row or column", i+1)
+		}
+		if math.IsNaN(cp.pt.X) || math.IsInf(cp.pt.X, 0) || math.IsNaN(cp.pt.Y) || math.IsInf(cp.pt.Y, 0) {
+			return nil, fmt.Errorf("CSV record %d specifies a non-finite coordinate", i+1)
+		}
+		if cp.c >= nx {
+			nx = cp.c + 1
+		}
+		if cp.r >= ny {
+			ny = cp.r + 1
+		}
+		cps[i] = cp
+	}
+
+	// Ensure every mesh point is specified exactly once.
+	if nx < 4 || ny < 4 {
+		return nil, fmt.Errorf("mesh must be at least 4x4 (read %dx%d)", nx, ny)
+	}
+	if nx*ny != len(cps) {
+		return nil, fmt.Errorf("a %dx%d mesh requires %d CSV records, but %d were read", nx, ny, nx*ny, len(cps))
+	}
+	sl := make([][]Point, ny)
+	seen := make([][]bool, ny)
+	for j := range sl {
+		sl[j] = make([]Point, nx)
+		seen[j] = make([]bool, nx)
+	}
+	for _, cp := range cps {
+		if seen[cp.r][cp.c] {
+			return nil, fmt.Errorf("mesh point (%d, %d) appears more than once in the CSV data", cp.c, cp.r)
+		}
+		seen[cp.r][cp.c] = true
+		sl[cp.r][cp.c] = cp.pt
+	}
+
+	// Create and return a Mesh object.
+	m := MeshFromPoints(sl)
+	for _, cp := range cps {
+		m.SetLabel(cp.c, cp.r, cp.label)
+	}
+	return m, nil
+}
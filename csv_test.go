@@ -0,0 +1,81 @@
+// The functions defined in this file ensure the xmorph package's CSV
+// operations work as expected.
+
+package xmorph
+
+import (
+	"bytes"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// TestCSVRoundTrip ensures that a mesh written with WriteCSV can be read back
+// with ReadMeshCSV.
+func TestCSVRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(30))
+	m1 := MeshFromPoints(random2DPoints(rng, 7, 5))
+	defer m1.Free()
+	m1.SetLabel(2, 3, 1)
+	m1.SetLabel(6, 0, 4)
+	var buf bytes.Buffer
+	if err := m1.WriteCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	m2, err := ReadMeshCSV(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m2.Free()
+	validateMeshDimens(t, m2, 7, 5)
+	comparePointSlices(t, m1.Points(), m2.Points())
+	for r := 0; r < 5; r++ {
+		for c := 0; c < 7; c++ {
+			if l1, l2 := m1.GetLabel(c, r), m2.GetLabel(c, r); l1 != l2 {
+				t.Fatalf("expected (%d, %d) to have label %d but saw %d", c, r, l1, l2)
+			}
+		}
+	}
+}
+
+// TestReadMeshCSV ensures that ReadMeshCSV accepts headerless, unordered,
+// label-free input and rejects incomplete input.
+func TestReadMeshCSV(t *testing.T) {
+	var sb strings.Builder
+	for r := 3; r >= 0; r-- {
+		for c := 3; c >= 0; c-- {
+			sb.WriteString(strings.Join([]string{
+				string('0' + rune(r)),
+				string('0' + rune(c)),
+				string('0'+rune(c)) + ".5",
+				string('0'+rune(r)) + ".25",
+			}, ", ") + "\n")
+		}
+	}
+	m, err := ReadMeshCSV(strings.NewReader(sb.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Free()
+	for r := 0; r < 4; r++ {
+		for c := 0; c < 4; c++ {
+			exp := Point{X: float64(c) + 0.5, Y: float64(r) + 0.25}
+			if pt := m.Get(c, r); pt != exp {
+				t.Fatalf("expected (%d, %d) = %v but saw %v", c, r, exp, pt)
+			}
+		}
+	}
+
+	// Remove and duplicate a line.
+	lines := strings.Split(sb.String(), "\n")
+	bad := []string{
+		strings.Join(lines[1:], "\n"),
+		strings.Join(append(lines[1:], lines[2]), "\n"),
+		strings.Replace(sb.String(), "3.5", "three", 1),
+	}
+	for _, b := range bad {
+		if _, err = ReadMeshCSV(strings.NewReader(b)); err == nil {
+			t.Fatalf("expected an error when reading %q", b)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+// This file provides functions for deforming a mesh to match a sparse set of
+// control-point correspondences.
+
+package xmorph
+
+import (
+	"fmt"
+	"math"
+)
+
+// A DeformMethod selects the scattered-data interpolation method DeformMesh
+// uses to spread control-point displacements across a mesh.
+type DeformMethod int
+
+// These are the values that a DeformMethod variable can accept.
+const (
+	ThinPlateSpline    DeformMethod = iota // Minimum-bending-energy interpolation
+	MovingLeastSquares                     // Affine moving-least-squares deformation
+)
+
+// tpsKernel is the thin-plate-spline radial basis function r² log r.
+func tpsKernel(p, q Point) float64 {
+	r2 := (p.X-q.X)*(p.X-q.X) + (p.Y-q.Y)*(p.Y-q.Y)
+	if r2 == 0.0 {
+		return 0.0
+	}
+	return r2 * math.Log(r2) / 2.0
+}
+
+// A tpsMapping is a thin-plate spline that maps source points to destination
+// points.
+type tpsMapping struct {
+	ctl    []Point   // Control points
+	wx, wy []float64 // Kernel weights followed by affine coefficients
+}
+
+// newTPSMapping fits a thin-plate spline that maps each src[i] to dst[i].
+func newTPSMapping(src, dst []Point) (*tpsMapping, error) {
+	// Construct the linear system.
+	n := len(src)
+	a := make([][]float64, n+3)
+	for i := range a {
+		a[i] = make([]float64, n+3)
+	}
+	bx := make([]float64, n+3)
+	by := make([]float64, n+3)
+	for i, p := range src {
+		for j, q := range src {
+			a[i][j] = tpsKernel(p, q)
+		}
+		a[i][n], a[i][n+1], a[i][n+2] = 1.0, p.X, p.Y
+		a[n][i], a[n+1][i], a[n+2][i] = 1.0, p.X, p.Y
+		bx[i], by[i] = dst[i].X, dst[i].Y
+	}
+
+	// Solve for the weights.
+	wx, err := solveLinear(a, bx)
+	if err != nil {
+		return nil, err
+	}
+	wy, err := solveLinear(a, by)
+	if err != nil {
+		return nil, err
+	}
+	return &tpsMapping{ctl: src, wx: wx, wy: wy}, nil
+}
+
+// Apply maps a point through a thin-plate spline.
+func (t *tpsMapping) Apply(p Point) Point {
+	n := len(t.ctl)
+	q := Point{
+		X: t.wx[n] + t.wx[n+1]*p.X + t.wx[n+2]*p.Y,
+		Y: t.wy[n] + t.wy[n+1]*p.X + t.wy[n+2]*p.Y,
+	}
+	for i, c := range t.ctl {
+		k := tpsKernel(p, c)
+		q.X += t.wx[i] * k
+		q.Y += t.wy[i] * k
+	}
+	return q
+}
+
+// An mlsMapping is an affine moving-least-squares deformation (Schaefer,
+// McPhail, and Warren, 2006) that maps source points to destination points.
+type mlsMapping struct {
+	src, dst []Point // Corresponding control points
+}
+
+// Apply maps a point through a moving-least-squares deformation.
+func (t *mlsMapping) Apply(v Point) Point {
+	// Weight each control point by its inverse squared distance to v.
+	w := make([]float64, len(t.src))
+	var wSum float64
+	var pStar, qStar Point
+	for i, p := range t.src {
+		d2 := (p.X-v.X)*(p.X-v.X) + (p.Y-v.Y)*(p.Y-v.Y)
+		if d2 == 0.0 {
+			return t.dst[i]
+		}
+		w[i] = 1.0 / d2
+		wSum += w[i]
+		pStar = pStar.Add(p.Mul(w[i]))
+		qStar = qStar.Add(t.dst[i].Mul(w[i]))
+	}
+	pStar = pStar.Div(wSum)
+	qStar = qStar.Div(wSum)
+
+	// Solve for the best affine matrix M in (v - p*)·M + q*.
+	var a, b, d float64    // Symmetric Σ w p̂ᵀp̂ = [[a, b], [b, d]]
+	var e, f, g, h float64 // Σ w p̂ᵀq̂ = [[e, f], [g, h]]
+	for i, p := range t.src {
+		ph, qh := p.Sub(pStar), t.dst[i].Sub(qStar)
+		a += w[i] * ph.X * ph.X
+		b += w[i] * ph.X * ph.Y
+		d += w[i] * ph.Y * ph.Y
+		e += w[i] * ph.X * qh.X
+		f += w[i] * ph.X * qh.Y
+		g += w[i] * ph.Y * qh.X
+		h += w[i] * ph.Y * qh.Y
+	}
+	vh := v.Sub(pStar)
+	det := a*d - b*b
+	if math.Abs(det) < 1e-12*(a*d+1e-300) {
+		// The control points are collinear.  Fall back to a
+		// translation.
+		return vh.Add(qStar)
+	}
+	m00, m01 := (d*e-b*g)/det, (d*f-b*h)/det
+	m10, m11 := (a*g-b*e)/det, (a*h-b*f)/det
+	return Point{
+		X: vh.X*m00 + vh.Y*m10 + qStar.X,
+		Y: vh.X*m01 + vh.Y*m11 + qStar.Y,
+	}
+}
+
+// DeformMesh produces a destination mesh from a base (source) mesh and a
+// sparse set of control-point correspondences: each base-mesh point is moved
+// by a smooth deformation that maps every src[i] to dst[i].  The base mesh's
+// edge points are treated as additional, fixed control points so the result
+// keeps its edges on the image boundary, as Warp and Morph require.  The base
+// mesh and the result are compatible and can be passed directly to Warp or
+// Morph.
+//
+// Large or contradictory displacements can fold the result over; use
+// Mesh.Validate to detect this and Mesh.Functionalize to repair it.
+func DeformMesh(base *Mesh, src, dst []Point, method DeformMethod) (*Mesh, error) {
+	// Sanity check our arguments.
+	if len(src) != len(dst) {
+		return nil, fmt.Errorf("DeformMesh requires equal numbers of source and destination points (saw %d and %d)", len(src), len(dst))
+	}
+	if len(src) == 0 {
+		return nil, fmt.Errorf("DeformMesh requires at least one control point")
+	}
+
+	// Add the base mesh's edge points as fixed controls, skipping any that
+	// duplicate a user-specified control point.
+	pts := base.Points()
+	ny, nx := len(pts), len(pts[0])
+	seen := make(map[Point]bool, len(src))
+	for _, p := range src {
+		if seen[p] {
+			return nil, fmt.Errorf("source control point %v appears more than once", p)
+		}
+		seen[p] = true
+	}
+	allSrc := append([]Point(nil), src...)
+	allDst := append([]Point(nil), dst...)
+	for r := 0; r < ny; r++ {
+		for c := 0; c < nx; c++ {
+			if r != 0 && c != 0 && r != ny-1 && c != nx-1 {
+				continue
+			}
+			p := pts[r][c]
+			if seen[p] {
+				continue
+			}
+			seen[p] = true
+			allSrc = append(allSrc, p)
+			allDst = append(allDst, p)
+		}
+	}
+
+	// Construct the mapping.
+	var xform Transform
+	switch method {
+	case ThinPlateSpline:
+		tps, err := newTPSMapping(allSrc, allDst)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fit a thin-plate spline (%w)", err)
+		}
+		xform = tps
+	case MovingLeastSquares:
+		xform = &mlsMapping{src: allSrc, dst: allDst}
+	default:
+		return nil, fmt.Errorf("unexpected deformation method %d", method)
+	}
+
+	// Apply the mapping to every interior point.
+	for r := 1; r < ny-1; r++ {
+		for c := 1; c < nx-1; c++ {
+			pts[r][c] = xform.Apply(pts[r][c])
+		}
+	}
+	return MeshFromPoints(pts), nil
+}
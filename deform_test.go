@@ -0,0 +1,87 @@
+// The functions defined in this file ensure the xmorph package's
+// control-point deformation operations work as expected.
+
+package xmorph
+
+import (
+	"testing"
+)
+
+// TestDeformMeshControls ensures that mesh points coinciding with source
+// control points move exactly to the destination control points, that edges
+// remain fixed, and that other points move smoothly.
+func TestDeformMeshControls(t *testing.T) {
+	const nx, ny, wd, ht = 9, 9, 161, 161
+	base := NewRegularMesh(nx, ny, wd, ht)
+	defer base.Free()
+	src := []Point{base.Get(2, 3), base.Get(6, 3), base.Get(4, 6)}
+	dst := []Point{{45, 55}, {118, 62}, {80, 110}}
+	for _, method := range []DeformMethod{ThinPlateSpline, MovingLeastSquares} {
+		m, err := DeformMesh(base, src, dst, method)
+		if err != nil {
+			t.Fatal(err)
+		}
+		validateMeshDimens(t, m, nx, ny)
+		for i, idx := range [][2]int{{2, 3}, {6, 3}, {4, 6}} {
+			if p := m.Get(idx[0], idx[1]); !p.Eq(dst[i], 1e-6) {
+				t.Fatalf("method %d: expected (%d, %d) = %v but saw %v", method, idx[0], idx[1], dst[i], p)
+			}
+		}
+		for r := 0; r < ny; r++ {
+			for c := 0; c < nx; c++ {
+				if r != 0 && c != 0 && r != ny-1 && c != nx-1 {
+					continue
+				}
+				if p, q := m.Get(c, r), base.Get(c, r); p != q {
+					t.Fatalf("method %d: edge point (%d, %d) moved from %v to %v", method, c, r, q, p)
+				}
+			}
+		}
+		if rep := m.Validate(wd, ht); !rep.OK() {
+			t.Fatalf("method %d: deformed mesh is invalid: %+v", method, rep)
+		}
+		m.Free()
+	}
+}
+
+// TestDeformMeshIdentity ensures that identical source and destination
+// control points leave the mesh unchanged.
+func TestDeformMeshIdentity(t *testing.T) {
+	const nx, ny, wd, ht = 7, 6, 120, 100
+	base := NewRegularMesh(nx, ny, wd, ht)
+	defer base.Free()
+	ctl := []Point{{30.5, 40.25}, {77, 21}, {60, 70}, {90, 55}}
+	for _, method := range []DeformMethod{ThinPlateSpline, MovingLeastSquares} {
+		m, err := DeformMesh(base, ctl, ctl, method)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for r := 0; r < ny; r++ {
+			for c := 0; c < nx; c++ {
+				if p, q := m.Get(c, r), base.Get(c, r); !p.Eq(q, 1e-6) {
+					t.Fatalf("method %d: expected (%d, %d) = %v but saw %v", method, c, r, q, p)
+				}
+			}
+		}
+		m.Free()
+	}
+}
+
+// TestDeformMeshErrors ensures that DeformMesh rejects invalid arguments.
+func TestDeformMeshErrors(t *testing.T) {
+	base := NewRegularMesh(5, 5, 50, 50)
+	defer base.Free()
+	p, q := Point{X: 10, Y: 10}, Point{X: 20, Y: 20}
+	if _, err := DeformMesh(base, []Point{p}, []Point{p, q}, ThinPlateSpline); err == nil {
+		t.Fatal("expected mismatched control-point counts to be rejected")
+	}
+	if _, err := DeformMesh(base, nil, nil, ThinPlateSpline); err == nil {
+		t.Fatal("expected an empty set of control points to be rejected")
+	}
+	if _, err := DeformMesh(base, []Point{p, p}, []Point{p, q}, ThinPlateSpline); err == nil {
+		t.Fatal("expected duplicate control points to be rejected")
+	}
+	if _, err := DeformMesh(base, []Point{p}, []Point{q}, DeformMethod(99)); err == nil {
+		t.Fatal("expected an invalid method to be rejected")
+	}
+}
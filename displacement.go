@@ -0,0 +1,279 @@
+// This file provides functions for converting mesh warps to and from dense,
+// per-pixel displacement fields.
+
+package xmorph
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+)
+
+// A DisplacementField describes a warp as a per-pixel offset.  The pixel at
+// (x, y) in the warped image is sampled from location (x + DX[i], y + DY[i])
+// in the original image, where i = y·Width + x.  This is the form expected by
+// most GPU shaders, which compute each output pixel independently.
+type DisplacementField struct {
+	Width  int       // Width of the image in pixels
+	Height int       // Height of the image in pixels
+	DX     []float32 // Horizontal offsets in row-major order
+	DY     []float32 // Vertical offsets in row-major order
+}
+
+// NewDisplacementField evaluates the warp from a source mesh to a
+// destination mesh at every pixel of a wd×ht image, producing a
+// DisplacementField.  Warping an image by the result is equivalent to Warp
+// with t = 1.0; use InterpolateMeshes to produce a destination mesh for
+// other values of t.  Like libmorph, which resamples an intermediate image
+// at whole scanlines, NewDisplacementField undoes the horizontal pass once
+// per scanline and interpolates between scanlines, so its displacements agree
+// with MeshMapping.InverseMap to within a few hundredths of a pixel.
+// NewDisplacementField returns an error if the meshes are incompatible.
+func NewDisplacementField(src, dst *Mesh, wd, ht int) (*DisplacementField, error) {
+	if wd <= 0 || ht <= 0 {
+		return nil, fmt.Errorf("invalid displacement-field dimensions %dx%d", wd, ht)
+	}
+	mm, err := NewMeshMapping(src, dst)
+	if err != nil {
+		return nil, err
+	}
+	f := &DisplacementField{
+		Width:  wd,
+		Height: ht,
+		DX:     make([]float32, wd*ht),
+		DY:     make([]float32, wd*ht),
+	}
+
+	// Undo the horizontal pass once per scanline, recording the source x
+	// coordinate of every pixel of the intermediate image.
+	sxs := make([][]float64, ht)
+	for y := range sxs {
+		yf := float64(y)
+		horiz := newHermiteSpline(evalAll(mm.srcCols, yf), evalAll(mm.midCols, yf))
+		sxs[y] = make([]float64, wd)
+		for x := range sxs[y] {
+			sxs[y][x] = horiz.invert(float64(x))
+		}
+	}
+
+	// Undo the vertical pass once per column, interpolating the source x
+	// coordinates between scanlines of the intermediate image.
+	col := make([]float64, ht)
+	for x := 0; x < wd; x++ {
+		xf := float64(x)
+		vert := newHermiteSpline(evalAll(mm.midRows, xf), evalAll(mm.dstRows, xf))
+		for y := range col {
+			col[y] = sxs[y][x]
+		}
+		for y := 0; y < ht; y++ {
+			yf := float64(y)
+			sy := vert.invert(yf)
+			i := y*wd + x
+			f.DX[i] = float32(catmullRom(col, sy) - xf)
+			f.DY[i] = float32(sy - yf)
+		}
+	}
+	return f, nil
+}
+
+// catmullRom interpolates a uniformly sampled function, given as a slice of
+// samples at 0, 1, 2, ..., at an arbitrary coordinate using a Catmull–Rom
+// spline.  Samples beyond either end replicate the end sample.
+func catmullRom(v []float64, t float64) float64 {
+	n := len(v)
+	at := func(i int) float64 { return v[clampInt(i, 0, n-1)] }
+	i := int(math.Floor(t))
+	u := t - float64(i)
+	p0, p1, p2, p3 := at(i-1), at(i), at(i+1), at(i+2)
+	return p1 + 0.5*u*(p2-p0+u*(2.0*p0-5.0*p1+4.0*p2-p3+u*(3.0*(p1-p2)+p3-p0)))
+}
+
+// At returns the displacement of the pixel at (x, y).
+func (f *DisplacementField) At(x, y int) (dx, dy float32) {
+	if x < 0 || y < 0 || x >= f.Width || y >= f.Height {
+		panic(fmt.Sprintf("(%d, %d) lies outside the %dx%d displacement field", x, y, f.Width, f.Height))
+	}
+	i := y*f.Width + x
+	return f.DX[i], f.DY[i]
+}
+
+// encodeFlow maps a displacement in [-maxDisp, maxDisp] to a uint16.
+func encodeFlow(d float32, maxDisp float64) uint16 {
+	v := (float64(d)/maxDisp + 1.0) * 0.5 * 65535.0
+	return uint16(math.Round(math.Max(0.0, math.Min(v, 65535.0))))
+}
+
+// decodeFlow maps a uint16 produced by encodeFlow back to a displacement.
+func decodeFlow(v uint16, maxDisp float64) float32 {
+	return float32((float64(v)/65535.0*2.0 - 1.0) * maxDisp)
+}
+
+// FlowMap encodes a DisplacementField as an image, suitable for uploading as
+// a texture.  Horizontal displacements are stored in the red channel and
+// vertical displacements in the green channel, each mapped linearly from
+// [-maxDisp, maxDisp] to [0, 65535].  Displacements outside that range are
+// clamped.  The blue channel is zero and the alpha channel is opaque.
+func (f *DisplacementField) FlowMap(maxDisp float64) *image.NRGBA64 {
+	if maxDisp <= 0.0 {
+		panic("FlowMap requires a positive maximum displacement")
+	}
+	img := image.NewNRGBA64(image.Rect(0, 0, f.Width, f.Height))
+	for y := 0; y < f.Height; y++ {
+		for x := 0; x < f.Width; x++ {
+			i := y*f.Width + x
+			r := encodeFlow(f.DX[i], maxDisp)
+			g := encodeFlow(f.DY[i], maxDisp)
+			o := img.PixOffset(x, y)
+			img.Pix[o+0] = uint8(r >> 8)
+			img.Pix[o+1] = uint8(r)
+			img.Pix[o+2] = uint8(g >> 8)
+			img.Pix[o+3] = uint8(g)
+			img.Pix[o+4] = 0
+			img.Pix[o+5] = 0
+			img.Pix[o+6] = 0xff
+			img.Pix[o+7] = 0xff
+		}
+	}
+	return img
+}
+
+// DisplacementFieldFromFlowMap decodes a flow map produced by FlowMap, given
+// the same maximum displacement used to encode it.
+func DisplacementFieldFromFlowMap(img *image.NRGBA64, maxDisp float64) *DisplacementField {
+	if maxDisp <= 0.0 {
+		panic("DisplacementFieldFromFlowMap requires a positive maximum displacement")
+	}
+	bnds := img.Bounds()
+	wd, ht := bnds.Dx(), bnds.Dy()
+	f := &DisplacementField{
+		Width:  wd,
+		Height: ht,
+		DX:     make([]float32, wd*ht),
+		DY:     make([]float32, wd*ht),
+	}
+	for y := 0; y < ht; y++ {
+		for x := 0; x < wd; x++ {
+			o := img.PixOffset(x+bnds.Min.X, y+bnds.Min.Y)
+			r := uint16(img.Pix[o+0])<<8 | uint16(img.Pix[o+1])
+			g := uint16(img.Pix[o+2])<<8 | uint16(img.Pix[o+3])
+			i := y*wd + x
+			f.DX[i] = decodeFlow(r, maxDisp)
+			f.DY[i] = decodeFlow(g, maxDisp)
+		}
+	}
+	return f
+}
+
+// clampInt clamps an integer to the range [lo, hi].
+func clampInt(v, lo, hi int) int {
+	switch {
+	case v < lo:
+		return lo
+	case v > hi:
+		return hi
+	}
+	return v
+}
+
+// meshes returns a pair of meshes with one point per pixel that describe the
+// same warp as a displacement field: a source mesh whose points lie at the
+// locations the pixels are sampled from and a destination mesh whose points
+// lie at the pixel centers.  Because libmorph requires mesh edges to lie on
+// the image boundary, sample locations on the field's outer rows and columns
+// are moved to the boundary.  meshes returns an error if the resulting
+// source mesh folds, as libmorph cannot warp by folded meshes.
+func (f *DisplacementField) meshes() (*Mesh, *Mesh, error) {
+	dst := NewRegularMesh(f.Width, f.Height, f.Width, f.Height)
+	sp := make([][]Point, f.Height)
+	for y := range sp {
+		sp[y] = make([]Point, f.Width)
+		for x := range sp[y] {
+			i := y*f.Width + x
+			sp[y][x] = Point{X: float64(x) + float64(f.DX[i]), Y: float64(y) + float64(f.DY[i])}
+		}
+	}
+	snapEdges(sp, dst.Points())
+	for y, row := range sp {
+		for x, p := range row {
+			if (x > 0 && p.X <= row[x-1].X) || (y > 0 && p.Y <= sp[y-1][x].Y) {
+				dst.Free()
+				return nil, nil, fmt.Errorf("displacement field folds at (%d, %d)", x, y)
+			}
+		}
+	}
+	return MeshFromPoints(sp), dst, nil
+}
+
+// warpPremultiplied warps an image with alpha, premultiplying its colors by
+// alpha beforehand so that transparent pixels contribute no color to their
+// neighbors, and returns the result as an NRGBA image.
+func warpPremultiplied(img image.Image, src, dst *Mesh) *image.NRGBA {
+	bnds := img.Bounds()
+	rgba := image.NewRGBA(bnds)
+	draw.Draw(rgba, bnds, img, bnds.Min, draw.Src)
+	out := &image.RGBA{
+		Pix:    warpUint8Slice(rgba.Pix, rgba.Stride, 4, rgba.Rect, src, dst),
+		Stride: rgba.Stride,
+		Rect:   rgba.Rect,
+	}
+
+	// Antialiasing kernels with negative lobes can leave a color greater
+	// than its alpha, which is not a valid premultiplied color.
+	for i := 0; i < len(out.Pix); i += 4 {
+		for ch := 0; ch < 3; ch++ {
+			if out.Pix[i+ch] > out.Pix[i+3] {
+				out.Pix[i+ch] = out.Pix[i+3]
+			}
+		}
+	}
+	nrgba := image.NewNRGBA(bnds)
+	draw.Draw(nrgba, bnds, out, bnds.Min, draw.Src)
+	return nrgba
+}
+
+// WarpDisplacement distorts an image according to a displacement field
+// rather than a pair of meshes.  The field is converted to a pair of meshes
+// with one point per pixel and passed to the same libmorph resampler that
+// Warp uses, so the result honors the Antialiasing setting.  Because libmorph
+// requires mesh edges to lie on the image boundary, pixels on the image's
+// edges are sampled from the boundary in the direction perpendicular to the
+// edge, whatever the field says.  For a field produced by
+// NewDisplacementField, the result closely approximates Warp but can differ
+// slightly, as the field itself approximates the mesh warp.
+//
+// Gray, CMYK, and Alpha images are warped as is and keep their type.  All
+// other images are converted to 8-bit RGBA with colors premultiplied by
+// alpha, so that transparent pixels do not bleed into their neighbors, and
+// are returned as an *image.NRGBA.  Hence, translucent images differ from
+// Warp's output, which does not premultiply, and 16-bit images lose
+// precision, as libmorph resamples only 8-bit channels.
+//
+// WarpDisplacement returns an error if the field's dimensions do not match
+// the image's, if the field is smaller than 4x4, or if the field folds
+// (i.e., if the sample locations do not increase strictly from left to right
+// along every row and from top to bottom along every column).
+func WarpDisplacement(img image.Image, f *DisplacementField) (image.Image, error) {
+	bnds := img.Bounds()
+	if bnds.Dx() != f.Width || bnds.Dy() != f.Height {
+		return nil, fmt.Errorf("a %dx%d displacement field cannot warp a %dx%d image", f.Width, f.Height, bnds.Dx(), bnds.Dy())
+	}
+	if bnds.Empty() {
+		return img, nil
+	}
+	if f.Width < 4 || f.Height < 4 {
+		return nil, fmt.Errorf("displacement field must be at least 4x4 (saw %dx%d)", f.Width, f.Height)
+	}
+	src, dst, err := f.meshes()
+	if err != nil {
+		return nil, err
+	}
+	defer src.Free()
+	defer dst.Free()
+	switch img := img.(type) {
+	case *image.Gray, *image.CMYK, *image.Alpha:
+		return warpCompletely(img, src, dst)
+	default:
+		return warpPremultiplied(img, src, dst), nil
+	}
+}
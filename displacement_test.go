@@ -0,0 +1,287 @@
+// The functions defined in this file ensure the xmorph package's
+// displacement-field operations work as expected.
+
+package xmorph
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// TestDisplacementFieldIdentity ensures that identical meshes produce an
+// all-zero displacement field.
+func TestDisplacementFieldIdentity(t *testing.T) {
+	m := NewRegularMesh(5, 4, 40, 30)
+	defer m.Free()
+	f, err := NewDisplacementField(m, m, 40, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for y := 0; y < f.Height; y++ {
+		for x := 0; x < f.Width; x++ {
+			dx, dy := f.At(x, y)
+			if math.Abs(float64(dx)) > 1e-4 || math.Abs(float64(dy)) > 1e-4 {
+				t.Fatalf("expected no displacement at (%d, %d) but saw (%v, %v)", x, y, dx, dy)
+			}
+		}
+	}
+}
+
+// TestDisplacementFieldMapping ensures that a displacement field agrees with
+// MeshMapping.InverseMap to within the error introduced by interpolating
+// between scanlines.
+func TestDisplacementFieldMapping(t *testing.T) {
+	const nx, ny, wd, ht = 6, 5, 81, 61
+	rng := rand.New(rand.NewSource(37))
+	src := NewRegularMesh(nx, ny, wd, ht)
+	defer src.Free()
+	dst := jaggedMesh(rng, nx, ny, wd, ht, 0.3)
+	defer dst.Free()
+	f, err := NewDisplacementField(src, dst, wd, ht)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mm, err := NewMeshMapping(src, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for y := 0; y < ht; y += 3 {
+		for x := 0; x < wd; x += 3 {
+			p := Point{X: float64(x), Y: float64(y)}
+			q := mm.InverseMap(p)
+			dx, dy := f.At(x, y)
+			got := p.Add(Point{X: float64(dx), Y: float64(dy)})
+			if !got.Eq(q, 0.05) {
+				t.Fatalf("expected (%d, %d) to be sampled from %v but saw %v", x, y, q, got)
+			}
+		}
+	}
+
+	// Incompatible meshes should be rejected.
+	other := NewRegularMesh(nx+1, ny, wd, ht)
+	defer other.Free()
+	if _, err := NewDisplacementField(src, other, wd, ht); err == nil {
+		t.Fatal("expected incompatible meshes to be rejected")
+	}
+}
+
+// TestFlowMapRoundTrip ensures that a displacement field survives encoding
+// as a flow map to within the quantization error.
+func TestFlowMapRoundTrip(t *testing.T) {
+	const wd, ht, maxDisp = 17, 11, 8.0
+	rng := rand.New(rand.NewSource(370))
+	f := &DisplacementField{
+		Width:  wd,
+		Height: ht,
+		DX:     make([]float32, wd*ht),
+		DY:     make([]float32, wd*ht),
+	}
+	for i := range f.DX {
+		f.DX[i] = float32((rng.Float64()*2.0 - 1.0) * maxDisp)
+		f.DY[i] = float32((rng.Float64()*2.0 - 1.0) * maxDisp)
+	}
+	f.DX[0] = 2.0 * maxDisp // Should be clamped.
+	img := f.FlowMap(maxDisp)
+	if c := img.NRGBA64At(3, 4); c.B != 0 || c.A != 0xffff {
+		t.Fatalf("expected zero blue and opaque alpha but saw %v", c)
+	}
+	g := DisplacementFieldFromFlowMap(img, maxDisp)
+	if g.Width != wd || g.Height != ht {
+		t.Fatalf("expected a %dx%d field but saw %dx%d", wd, ht, g.Width, g.Height)
+	}
+	tol := maxDisp / 65535.0
+	if math.Abs(float64(g.DX[0])-maxDisp) > tol {
+		t.Fatalf("expected %v to be clamped to %v but saw %v", f.DX[0], maxDisp, g.DX[0])
+	}
+	for i := 1; i < wd*ht; i++ {
+		if math.Abs(float64(g.DX[i]-f.DX[i])) > tol || math.Abs(float64(g.DY[i]-f.DY[i])) > tol {
+			t.Fatalf("expected (%v, %v) but saw (%v, %v)", f.DX[i], f.DY[i], g.DX[i], g.DY[i])
+		}
+	}
+}
+
+// TestDisplacementFieldMeshes ensures that the meshes built from a
+// displacement field keep their edges on the image boundary and that fields
+// that fold once their edges are snapped are rejected.
+func TestDisplacementFieldMeshes(t *testing.T) {
+	const wd, ht = 20, 15
+	f := &DisplacementField{
+		Width:  wd,
+		Height: ht,
+		DX:     make([]float32, wd*ht),
+		DY:     make([]float32, wd*ht),
+	}
+	for i := range f.DX {
+		f.DX[i] = 0.25
+		f.DY[i] = -0.5
+	}
+	src, dst, err := f.meshes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Free()
+	defer dst.Free()
+	for y := 0; y < ht; y++ {
+		for x := 0; x < wd; x++ {
+			want := Point{X: float64(x) + 0.25, Y: float64(y) - 0.5}
+			switch x {
+			case 0, wd - 1:
+				want.X = float64(x)
+			}
+			switch y {
+			case 0, ht - 1:
+				want.Y = float64(y)
+			}
+			if p := src.Get(x, y); !p.Eq(want, 1e-6) {
+				t.Fatalf("expected source point %v at (%d, %d) but saw %v", want, x, y, p)
+			}
+			if p := dst.Get(x, y); !p.Eq(Point{X: float64(x), Y: float64(y)}, 1e-9) {
+				t.Fatalf("expected destination point (%d, %d) but saw %v", x, y, p)
+			}
+		}
+	}
+
+	// A uniform shift of more than a pixel pushes interior samples past
+	// the snapped edges.
+	for i := range f.DX {
+		f.DX[i] = 3
+		f.DY[i] = -2
+	}
+	if _, _, err := f.meshes(); err == nil {
+		t.Fatal("expected a shift past the image boundary to be rejected")
+	}
+}
+
+// TestWarpDisplacementMatchesWarp ensures that warping by a displacement
+// field produced by NewDisplacementField closely approximates Warp.
+func TestWarpDisplacementMatchesWarp(t *testing.T) {
+	const nx, ny, wd, ht = 6, 5, 81, 61
+	rng := rand.New(rand.NewSource(371))
+	src := NewRegularMesh(nx, ny, wd, ht)
+	defer src.Free()
+	dst := jaggedMesh(rng, nx, ny, wd, ht, 0.3)
+	defer dst.Free()
+	img := image.NewNRGBA(image.Rect(0, 0, wd, ht))
+	for y := 0; y < ht; y++ {
+		for x := 0; x < wd; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{R: uint8(x * 3), G: uint8(y * 4), B: uint8((x + y) * 2), A: 255})
+		}
+	}
+	f, err := NewDisplacementField(src, dst, wd, ht)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := WarpDisplacement(img, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := Warp(img, src, dst, 1.0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, exp := out.(*image.NRGBA), want.(*image.NRGBA)
+	diff := func(a, b uint8) int {
+		if a > b {
+			return int(a - b)
+		}
+		return int(b - a)
+	}
+	for y := 0; y < ht; y++ {
+		for x := 0; x < wd; x++ {
+			c, e := got.NRGBAAt(x, y), exp.NRGBAAt(x, y)
+			if diff(c.R, e.R) > 3 || diff(c.G, e.G) > 3 || diff(c.B, e.B) > 3 || c.A != e.A {
+				t.Fatalf("expected %v at (%d, %d) but saw %v", e, x, y, c)
+			}
+		}
+	}
+}
+
+// TestWarpDisplacementTypes ensures that WarpDisplacement preserves the type
+// of common images, converts other images to NRGBA, and rejects fields of
+// the wrong size and fields that fold.
+func TestWarpDisplacementTypes(t *testing.T) {
+	const wd, ht = 8, 6
+	f := &DisplacementField{
+		Width:  wd,
+		Height: ht,
+		DX:     make([]float32, wd*ht),
+		DY:     make([]float32, wd*ht),
+	}
+	gray := image.NewGray(image.Rect(0, 0, wd, ht))
+	for x := 0; x < wd; x++ {
+		for y := 0; y < ht; y++ {
+			gray.SetGray(x, y, color.Gray{Y: uint8(x * 20)})
+		}
+	}
+	defer func(aa AAKernel) { Antialiasing = aa }(Antialiasing)
+	Antialiasing = Bilinear
+	out, err := WarpDisplacement(gray, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, ok := out.(*image.Gray)
+	if !ok {
+		t.Fatalf("expected an *image.Gray but saw %T", out)
+	}
+	if c := g.GrayAt(2, 3).Y; c != 40 {
+		t.Fatalf("expected an unwarped sample of 40 but saw %d", c)
+	}
+	out, err = WarpDisplacement(image.NewRGBA(image.Rect(0, 0, wd, ht)), f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := out.(*image.NRGBA); !ok {
+		t.Fatalf("expected an *image.NRGBA but saw %T", out)
+	}
+	if _, err := WarpDisplacement(image.NewGray(image.Rect(0, 0, wd+1, ht)), f); err == nil {
+		t.Fatal("expected a mismatched displacement field to be rejected")
+	}
+	f.DX[3*wd+4] = -2
+	if _, err := WarpDisplacement(gray, f); err == nil {
+		t.Fatal("expected a folded displacement field to be rejected")
+	}
+}
+
+// TestWarpDisplacementAlpha ensures that WarpDisplacement does not bleed
+// color from transparent pixels into their neighbors.
+func TestWarpDisplacementAlpha(t *testing.T) {
+	const wd, ht = 8, 6
+	img := image.NewNRGBA(image.Rect(0, 0, wd, ht))
+	for y := 0; y < ht; y++ {
+		for x := 0; x < wd; x++ {
+			c := color.NRGBA{R: 255, A: 0}
+			if x >= wd/2 {
+				c = color.NRGBA{B: 255, A: 255}
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	f := &DisplacementField{
+		Width:  wd,
+		Height: ht,
+		DX:     make([]float32, wd*ht),
+		DY:     make([]float32, wd*ht),
+	}
+	for i := range f.DX {
+		f.DX[i] = 0.5
+	}
+	defer func(aa AAKernel) { Antialiasing = aa }(Antialiasing)
+	for _, aa := range []AAKernel{NearestNeighbor, Bilinear, Lanczos, Lanczos4} {
+		Antialiasing = aa
+		out, err := WarpDisplacement(img, f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		warped := out.(*image.NRGBA)
+		for y := 0; y < ht; y++ {
+			for x := 0; x < wd; x++ {
+				if c := warped.NRGBAAt(x, y); c.A > 0 && c.R > 1 {
+					t.Fatalf("kernel %d: expected no red at (%d, %d) but saw %v", aa, x, y, c)
+				}
+			}
+		}
+	}
+}
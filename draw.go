@@ -0,0 +1,210 @@
+// This file provides functions for drawing a mesh onto an image.
+
+package xmorph
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+// A MeshStyle specifies how DrawMesh renders a mesh.
+type MeshStyle struct {
+	LineColor    color.Color // Color of the grid lines (nil = no lines)
+	LineWidth    float64     // Width of the grid lines in pixels
+	VertexColor  color.Color // Color of the vertex markers (nil = no markers)
+	VertexRadius float64     // Radius of the vertex markers in pixels
+	Splines      bool        // true = draw libmorph's interpolating splines; false = straight segments
+}
+
+// DefaultMeshStyle is a reasonable MeshStyle for overlaying a mesh on an
+// arbitrary image.
+var DefaultMeshStyle = MeshStyle{
+	LineColor:    color.NRGBA{R: 0, G: 255, B: 255, A: 192},
+	LineWidth:    1.0,
+	VertexColor:  color.NRGBA{R: 255, G: 255, B: 0, A: 255},
+	VertexRadius: 2.5,
+	Splines:      false,
+}
+
+// splineStep is the maximum distance in pixels between consecutive samples
+// when approximating a spline curve with line segments.
+const splineStep = 2.0
+
+// coverage is a per-pixel coverage mask used to accumulate antialiased shapes
+// before compositing them onto an image.
+type coverage struct {
+	mask *image.Alpha16 // Coverage of each pixel
+}
+
+// newCoverage allocates an empty coverage mask with the given bounds.
+func newCoverage(bnds image.Rectangle) *coverage {
+	return &coverage{mask: image.NewAlpha16(bnds)}
+}
+
+// add merges a coverage value in [0.0, 1.0] into pixel (x, y), retaining the
+// larger of the old and new values so overlapping shapes do not darken.
+func (cv *coverage) add(x, y int, a float64) {
+	if a <= 0.0 {
+		return
+	}
+	if a > 1.0 {
+		a = 1.0
+	}
+	v := uint16(math.Round(a * 0xffff))
+	i := cv.mask.PixOffset(x, y)
+	old := uint16(cv.mask.Pix[i])<<8 | uint16(cv.mask.Pix[i+1])
+	if v > old {
+		cv.mask.Pix[i] = uint8(v >> 8)
+		cv.mask.Pix[i+1] = uint8(v)
+	}
+}
+
+// segment adds an antialiased line segment of width wd from p to q.
+func (cv *coverage) segment(p, q Point, wd float64) {
+	// Determine the pixels the segment might cover.
+	hw := wd/2.0 + 1.0
+	r := image.Rect(
+		int(math.Floor(math.Min(p.X, q.X)-hw)),
+		int(math.Floor(math.Min(p.Y, q.Y)-hw)),
+		int(math.Ceil(math.Max(p.X, q.X)+hw))+1,
+		int(math.Ceil(math.Max(p.Y, q.Y)+hw))+1,
+	).Intersect(cv.mask.Rect)
+
+	// Assign each pixel a coverage based on the distance from its center
+	// to the segment.
+	d := q.Sub(p)
+	dd := d.X*d.X + d.Y*d.Y
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			c := Point{X: float64(x), Y: float64(y)}
+			t := 0.0
+			if dd > 0.0 {
+				v := c.Sub(p)
+				t = math.Max(0.0, math.Min(1.0, (v.X*d.X+v.Y*d.Y)/dd))
+			}
+			e := c.Sub(p.Add(d.Mul(t)))
+			dist := math.Hypot(e.X, e.Y)
+			cv.add(x, y, wd/2.0+0.5-dist)
+		}
+	}
+}
+
+// disc adds an antialiased filled circle of radius rad centered on p.
+func (cv *coverage) disc(p Point, rad float64) {
+	r := image.Rect(
+		int(math.Floor(p.X-rad-1.0)),
+		int(math.Floor(p.Y-rad-1.0)),
+		int(math.Ceil(p.X+rad+1.0))+1,
+		int(math.Ceil(p.Y+rad+1.0))+1,
+	).Intersect(cv.mask.Rect)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			dist := math.Hypot(float64(x)-p.X, float64(y)-p.Y)
+			cv.add(x, y, rad+0.5-dist)
+		}
+	}
+}
+
+// polyline adds a sequence of connected, antialiased line segments.
+func (cv *coverage) polyline(pts []Point, wd float64) {
+	for i := 1; i < len(pts); i++ {
+		cv.segment(pts[i-1], pts[i], wd)
+	}
+}
+
+// splineCurve samples a spline between knots a and b at intervals of at most
+// splineStep pixels.  If vert is true, the spline maps y to x; otherwise, it
+// maps x to y.  The result includes a but not b.
+func splineCurve(s *hermiteSpline, a, b Point, vert bool) []Point {
+	n := int(math.Ceil(math.Hypot(b.X-a.X, b.Y-a.Y) / splineStep))
+	if n < 1 {
+		n = 1
+	}
+	pts := make([]Point, 0, n)
+	for k := 0; k < n; k++ {
+		f := float64(k) / float64(n)
+		if vert {
+			y := a.Y + (b.Y-a.Y)*f
+			pts = append(pts, Point{X: s.eval(y), Y: y})
+		} else {
+			x := a.X + (b.X-a.X)*f
+			pts = append(pts, Point{X: x, Y: s.eval(x)})
+		}
+	}
+	return pts
+}
+
+// meshLines returns each row and column of a mesh as a polyline.  If splines
+// is true, the polylines approximate the curves libmorph interpolates between
+// mesh points; otherwise, they connect mesh points with straight segments.
+func meshLines(pts [][]Point, splines bool) [][]Point {
+	ny, nx := len(pts), len(pts[0])
+	lines := make([][]Point, 0, nx+ny)
+
+	// Trace each row.
+	for r, row := range pts {
+		if !splines {
+			lines = append(lines, row)
+			continue
+		}
+		s := rowSpline(pts, r)
+		var pl []Point
+		for c := 0; c < nx-1; c++ {
+			pl = append(pl, splineCurve(s, row[c], row[c+1], false)...)
+		}
+		lines = append(lines, append(pl, row[nx-1]))
+	}
+
+	// Trace each column.
+	for c := 0; c < nx; c++ {
+		col := make([]Point, ny)
+		for r := range pts {
+			col[r] = pts[r][c]
+		}
+		if !splines {
+			lines = append(lines, col)
+			continue
+		}
+		s := columnSpline(pts, c)
+		var pl []Point
+		for r := 0; r < ny-1; r++ {
+			pl = append(pl, splineCurve(s, col[r], col[r+1], true)...)
+		}
+		lines = append(lines, append(pl, col[ny-1]))
+	}
+	return lines
+}
+
+// DrawMesh draws a mesh's grid lines and vertices onto an image using a given
+// style.  Mesh coordinates are taken relative to the image's bounds.
+func DrawMesh(dst draw.Image, m *Mesh, style MeshStyle) {
+	bnds := dst.Bounds()
+	pts := m.Points()
+	for _, row := range pts {
+		for c := range row {
+			row[c] = row[c].Add(Point{X: float64(bnds.Min.X), Y: float64(bnds.Min.Y)})
+		}
+	}
+
+	// Draw the grid lines.
+	if style.LineColor != nil && style.LineWidth > 0.0 {
+		cv := newCoverage(bnds)
+		for _, pl := range meshLines(pts, style.Splines) {
+			cv.polyline(pl, style.LineWidth)
+		}
+		draw.DrawMask(dst, bnds, image.NewUniform(style.LineColor), image.Point{}, cv.mask, bnds.Min, draw.Over)
+	}
+
+	// Draw the vertex markers.
+	if style.VertexColor != nil && style.VertexRadius > 0.0 {
+		cv := newCoverage(bnds)
+		for _, row := range pts {
+			for _, pt := range row {
+				cv.disc(pt, style.VertexRadius)
+			}
+		}
+		draw.DrawMask(dst, bnds, image.NewUniform(style.VertexColor), image.Point{}, cv.mask, bnds.Min, draw.Over)
+	}
+}
@@ -0,0 +1,83 @@
+// The functions defined in this file ensure the xmorph package's mesh-drawing
+// operations work as expected.
+
+package xmorph
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+// TestDrawMesh ensures that DrawMesh draws lines and vertices where expected
+// and leaves the interior of cells untouched.
+func TestDrawMesh(t *testing.T) {
+	// Draw a regular mesh onto a white image.
+	const wd, ht = 61, 41
+	white := color.NRGBA{R: 255, G: 255, B: 255, A: 255}
+	img := image.NewNRGBA(image.Rect(0, 0, wd, ht))
+	draw.Draw(img, img.Bounds(), image.NewUniform(white), image.Point{}, draw.Src)
+	m := NewRegularMesh(7, 5, wd, ht)
+	defer m.Free()
+	style := MeshStyle{
+		LineColor:    color.NRGBA{R: 255, A: 255},
+		LineWidth:    1.0,
+		VertexColor:  color.NRGBA{B: 255, A: 255},
+		VertexRadius: 2.0,
+	}
+	DrawMesh(img, m, style)
+
+	// Check a few representative pixels.
+	tests := []struct {
+		x, y int
+		c    color.NRGBA
+	}{
+		{0, 0, color.NRGBA{B: 255, A: 255}},   // Vertex
+		{30, 20, color.NRGBA{B: 255, A: 255}}, // Vertex
+		{15, 0, color.NRGBA{R: 255, A: 255}},  // Horizontal line
+		{20, 25, color.NRGBA{R: 255, A: 255}}, // Vertical line
+		{5, 5, white},                         // Cell interior
+		{35, 15, white},                       // Cell interior
+		{55, 35, white},                       // Cell interior
+	}
+	for _, tst := range tests {
+		if c := img.NRGBAAt(tst.x, tst.y); c != tst.c {
+			t.Fatalf("expected (%d, %d) to be %v but saw %v", tst.x, tst.y, tst.c, c)
+		}
+	}
+}
+
+// TestDrawMeshSplines ensures that drawing a regular mesh with splines
+// produces the same image as drawing it with straight segments.
+func TestDrawMeshSplines(t *testing.T) {
+	const wd, ht = 50, 50
+	m := NewRegularMesh(6, 6, wd, ht)
+	defer m.Free()
+	style := DefaultMeshStyle
+	img1 := image.NewNRGBA(image.Rect(0, 0, wd, ht))
+	DrawMesh(img1, m, style)
+	style.Splines = true
+	img2 := image.NewNRGBA(image.Rect(0, 0, wd, ht))
+	DrawMesh(img2, m, style)
+	for i := range img1.Pix {
+		if img1.Pix[i] != img2.Pix[i] {
+			t.Fatalf("straight and spline drawings differ at byte %d", i)
+		}
+	}
+}
+
+// TestDrawMeshOffset ensures that DrawMesh honors an image's bounds.
+func TestDrawMeshOffset(t *testing.T) {
+	img := image.NewGray(image.Rect(100, 200, 140, 240))
+	m := NewRegularMesh(4, 4, 40, 40)
+	defer m.Free()
+	style := MeshStyle{VertexColor: color.White, VertexRadius: 1.0}
+	DrawMesh(img, m, style)
+	if c := img.GrayAt(100, 200); c.Y != 255 {
+		t.Fatalf("expected a vertex marker at (100, 200) but saw %v", c)
+	}
+	if c := img.GrayAt(120, 220); c.Y != 0 {
+		t.Fatalf("expected no marker at (120, 220) but saw %v", c)
+	}
+}
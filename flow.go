@@ -0,0 +1,280 @@
+// This file provides a dense optical-flow estimator and a function that uses
+// it to construct a destination mesh automatically from two images.
+
+package xmorph
+
+import (
+	"fmt"
+	"image"
+	"math"
+)
+
+// FlowOptions control the optical-flow estimation performed by EstimateFlow
+// and FlowMesh.
+type FlowOptions struct {
+	Levels       int           // Number of image-pyramid levels (0 = as many as fit, up to 5)
+	WindowRadius int           // Radius in pixels of the Lucas–Kanade window (0 = 7)
+	Iterations   int           // Lucas–Kanade iterations per pyramid level (0 = 5)
+	Smooth       SmoothOptions // Smoothing applied to FlowMesh's result (Iterations = 0 for none)
+}
+
+// withDefaults returns a copy of a set of FlowOptions with zero values
+// replaced by their defaults.  Levels is computed from the image size.
+func (opts FlowOptions) withDefaults(wd, ht int) (FlowOptions, error) {
+	switch {
+	case opts.Levels < 0:
+		return opts, fmt.Errorf("pyramid level count must be non-negative (saw %d)", opts.Levels)
+	case opts.WindowRadius < 0:
+		return opts, fmt.Errorf("window radius must be non-negative (saw %d)", opts.WindowRadius)
+	case opts.Iterations < 0:
+		return opts, fmt.Errorf("iteration count must be non-negative (saw %d)", opts.Iterations)
+	}
+	if opts.Levels == 0 {
+		opts.Levels = 1
+		for w, h := wd, ht; opts.Levels < 5 && w >= 64 && h >= 64; w, h = (w+1)/2, (h+1)/2 {
+			opts.Levels++
+		}
+	}
+	if opts.WindowRadius == 0 {
+		opts.WindowRadius = 7
+	}
+	if opts.Iterations == 0 {
+		opts.Iterations = 5
+	}
+	return opts, nil
+}
+
+// A lumaImage is a grayscale image with floating-point pixel values.
+type lumaImage struct {
+	pix    []float64 // Pixel values in row-major order
+	wd, ht int       // Image dimensions
+}
+
+// newLumaImage converts an image to a lumaImage.
+func newLumaImage(img image.Image) *lumaImage {
+	pix, wd, ht := lumaPlane(img)
+	return &lumaImage{pix: pix, wd: wd, ht: ht}
+}
+
+// at returns the pixel value at (x, y), replicating edge pixels beyond the
+// image's bounds.
+func (li *lumaImage) at(x, y int) float64 {
+	return li.pix[clampInt(y, 0, li.ht-1)*li.wd+clampInt(x, 0, li.wd-1)]
+}
+
+// sample returns the bilinearly interpolated pixel value at (x, y).
+func (li *lumaImage) sample(x, y float64) float64 {
+	x0, y0 := math.Floor(x), math.Floor(y)
+	fx, fy := x-x0, y-y0
+	ix, iy := int(x0), int(y0)
+	top := (1-fx)*li.at(ix, iy) + fx*li.at(ix+1, iy)
+	bot := (1-fx)*li.at(ix, iy+1) + fx*li.at(ix+1, iy+1)
+	return (1-fy)*top + fy*bot
+}
+
+// downsample returns an image half the size (rounded up) of li in each
+// dimension, averaging each 2×2 block of pixels.
+func (li *lumaImage) downsample() *lumaImage {
+	wd, ht := (li.wd+1)/2, (li.ht+1)/2
+	out := &lumaImage{pix: make([]float64, wd*ht), wd: wd, ht: ht}
+	for y := 0; y < ht; y++ {
+		for x := 0; x < wd; x++ {
+			out.pix[y*wd+x] = (li.at(2*x, 2*y) + li.at(2*x+1, 2*y) +
+				li.at(2*x, 2*y+1) + li.at(2*x+1, 2*y+1)) / 4.0
+		}
+	}
+	return out
+}
+
+// pyramid returns an image pyramid with a given number of levels, from full
+// resolution (level 0) to coarsest.
+func (li *lumaImage) pyramid(levels int) []*lumaImage {
+	pyr := []*lumaImage{li}
+	for len(pyr) < levels {
+		pyr = append(pyr, pyr[len(pyr)-1].downsample())
+	}
+	return pyr
+}
+
+// gradients returns the horizontal and vertical central-difference
+// gradients of an image.
+func (li *lumaImage) gradients() ([]float64, []float64) {
+	gx := make([]float64, li.wd*li.ht)
+	gy := make([]float64, li.wd*li.ht)
+	for y := 0; y < li.ht; y++ {
+		for x := 0; x < li.wd; x++ {
+			i := y*li.wd + x
+			gx[i] = (li.at(x+1, y) - li.at(x-1, y)) / 2.0
+			gy[i] = (li.at(x, y+1) - li.at(x, y-1)) / 2.0
+		}
+	}
+	return gx, gy
+}
+
+// products returns the element-wise product of two slices.
+func products(a, b []float64) []float64 {
+	p := make([]float64, len(a))
+	for i := range a {
+		p[i] = a[i] * b[i]
+	}
+	return p
+}
+
+// upsampleFlow doubles the resolution of a flow component to wd×ht,
+// doubling its values accordingly.
+func upsampleFlow(f []float64, fw, fh, wd, ht int) []float64 {
+	prev := &lumaImage{pix: f, wd: fw, ht: fh}
+	out := make([]float64, wd*ht)
+	for y := 0; y < ht; y++ {
+		for x := 0; x < wd; x++ {
+			out[y*wd+x] = 2.0 * prev.sample((float64(x)+0.5)/2.0-0.5, (float64(y)+0.5)/2.0-0.5)
+		}
+	}
+	return out
+}
+
+// EstimateFlow estimates the dense optical flow from img1 to img2 using the
+// pyramidal Lucas–Kanade method with square windows.  The result maps each
+// pixel of img1 to its location in img2: the pixel at (x, y) in img1
+// corresponds to location (x + DX[i], y + DY[i]) in img2.  Hence,
+// WarpDisplacement(img2, f) approximately reconstructs img1.  Flow is
+// reliable only near image texture; in flat regions it is whatever the
+// coarser pyramid levels estimated, or zero.
+// EstimateFlow returns an error if the images differ in size.
+func EstimateFlow(img1, img2 image.Image, opts FlowOptions) (*DisplacementField, error) {
+	b1, b2 := img1.Bounds(), img2.Bounds()
+	if b1.Dx() != b2.Dx() || b1.Dy() != b2.Dy() {
+		return nil, fmt.Errorf("images to compare must be the same size (saw %dx%d and %dx%d)", b1.Dx(), b1.Dy(), b2.Dx(), b2.Dy())
+	}
+	if b1.Empty() {
+		return nil, fmt.Errorf("images to compare must not be empty")
+	}
+	opts, err := opts.withDefaults(b1.Dx(), b1.Dy())
+	if err != nil {
+		return nil, err
+	}
+	pyr1 := newLumaImage(img1).pyramid(opts.Levels)
+	pyr2 := newLumaImage(img2).pyramid(opts.Levels)
+
+	// Refine the flow from the coarsest level to the finest.
+	var u, v []float64
+	rad := opts.WindowRadius
+	for l := opts.Levels - 1; l >= 0; l-- {
+		a, b := pyr1[l], pyr2[l]
+		wd, ht := a.wd, a.ht
+		if u == nil {
+			u = make([]float64, wd*ht)
+			v = make([]float64, wd*ht)
+		} else {
+			pw, ph := pyr1[l+1].wd, pyr1[l+1].ht
+			u = upsampleFlow(u, pw, ph, wd, ht)
+			v = upsampleFlow(v, pw, ph, wd, ht)
+		}
+
+		// Sum the structure tensor over each window.
+		gx, gy := a.gradients()
+		sxx := newSummedArea(products(gx, gx), wd, ht)
+		sxy := newSummedArea(products(gx, gy), wd, ht)
+		syy := newSummedArea(products(gy, gy), wd, ht)
+
+		// Iteratively solve for the flow increment in each window.
+		dt := make([]float64, wd*ht)
+		for it := 0; it < opts.Iterations; it++ {
+			for y := 0; y < ht; y++ {
+				for x := 0; x < wd; x++ {
+					i := y*wd + x
+					dt[i] = b.sample(float64(x)+u[i], float64(y)+v[i]) - a.pix[i]
+				}
+			}
+			sxt := newSummedArea(products(gx, dt), wd, ht)
+			syt := newSummedArea(products(gy, dt), wd, ht)
+			for y := 0; y < ht; y++ {
+				for x := 0; x < wd; x++ {
+					win := image.Rect(x-rad, y-rad, x+rad+1, y+rad+1)
+					gxx, gxy, gyy := sxx.mean(win), sxy.mean(win), syy.mean(win)
+					det := gxx*gyy - gxy*gxy
+					if det < 1e-12 {
+						continue // Too little texture to determine the flow
+					}
+					bx, by := -sxt.mean(win), -syt.mean(win)
+					i := y*wd + x
+					u[i] += (gyy*bx - gxy*by) / det
+					v[i] += (gxx*by - gxy*bx) / det
+				}
+			}
+		}
+	}
+
+	// Convert the flow to a DisplacementField.
+	wd, ht := pyr1[0].wd, pyr1[0].ht
+	f := &DisplacementField{
+		Width:  wd,
+		Height: ht,
+		DX:     make([]float32, wd*ht),
+		DY:     make([]float32, wd*ht),
+	}
+	for i := range u {
+		f.DX[i] = float32(u[i])
+		f.DY[i] = float32(v[i])
+	}
+	return f, nil
+}
+
+// sample returns the bilinearly interpolated displacement at (x, y),
+// replicating edge values beyond the field's bounds.
+func (f *DisplacementField) sample(x, y float64) (float64, float64) {
+	x0, y0 := math.Floor(x), math.Floor(y)
+	fx, fy := x-x0, y-y0
+	ix, iy := int(x0), int(y0)
+	var dx, dy float64
+	for _, c := range [4]struct {
+		x, y int
+		w    float64
+	}{
+		{ix, iy, (1 - fx) * (1 - fy)},
+		{ix + 1, iy, fx * (1 - fy)},
+		{ix, iy + 1, (1 - fx) * fy},
+		{ix + 1, iy + 1, fx * fy},
+	} {
+		i := clampInt(c.y, 0, f.Height-1)*f.Width + clampInt(c.x, 0, f.Width-1)
+		dx += c.w * float64(f.DX[i])
+		dy += c.w * float64(f.DY[i])
+	}
+	return dx, dy
+}
+
+// FlowMesh constructs a destination mesh for warping img1 towards img2,
+// given a source mesh drawn on img1.  It estimates the optical flow from
+// img1 to img2 with EstimateFlow and moves each source point by the flow at
+// its location.  Edge points are left unchanged because flow is unreliable
+// at the image boundary and libmorph requires edges to remain on it.  The
+// result is then smoothed according to opts.Smooth (with SmoothTaubin) and
+// passed through Functionalize so that it is always a valid mesh.
+func FlowMesh(img1, img2 image.Image, src *Mesh, opts FlowOptions) (*Mesh, error) {
+	if opts.Smooth.Iterations > 0 {
+		if err := opts.Smooth.validate(src); err != nil {
+			return nil, err
+		}
+	}
+	f, err := EstimateFlow(img1, img2, opts)
+	if err != nil {
+		return nil, err
+	}
+	pts := src.Points()
+	for r := 1; r < src.NY-1; r++ {
+		for c := 1; c < src.NX-1; c++ {
+			p := pts[r][c]
+			dx, dy := f.sample(p.X, p.Y)
+			pts[r][c] = Point{X: p.X + dx, Y: p.Y + dy}
+		}
+	}
+	dst := MeshFromPoints(pts)
+	if opts.Smooth.Iterations > 0 {
+		if err := dst.SmoothTaubin(opts.Smooth); err != nil {
+			dst.Free()
+			return nil, err
+		}
+	}
+	dst.Functionalize(f.Width, f.Height)
+	return dst, nil
+}
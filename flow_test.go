@@ -0,0 +1,109 @@
+// The functions defined in this file ensure the xmorph package's
+// optical-flow functions work as expected.
+
+package xmorph
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"sort"
+	"testing"
+)
+
+// texture returns a smooth, richly textured pattern with values in
+// [0.0, 1.0].
+func texture(x, y float64) float64 {
+	return 0.5 + 0.25*math.Sin(x/5.0+math.Sin(y/7.0)) + 0.25*math.Cos(y/4.3+0.5*math.Sin(x/9.0))
+}
+
+// textureImage renders a texture into a Gray16 image, applying a function
+// that maps each output pixel to the texture location it displays.
+func textureImage(wd, ht int, f func(x, y float64) (float64, float64)) *image.Gray16 {
+	img := image.NewGray16(image.Rect(0, 0, wd, ht))
+	for y := 0; y < ht; y++ {
+		for x := 0; x < wd; x++ {
+			tx, ty := f(float64(x), float64(y))
+			img.SetGray16(x, y, color.Gray16{Y: uint16(texture(tx, ty)*65535.0 + 0.5)})
+		}
+	}
+	return img
+}
+
+// median returns the median of a slice of values.
+func median(v []float64) float64 {
+	s := append([]float64(nil), v...)
+	sort.Float64s(s)
+	return s[len(s)/2]
+}
+
+// TestEstimateFlow ensures that EstimateFlow recovers a translation.
+func TestEstimateFlow(t *testing.T) {
+	const wd, ht = 128, 96
+	img1 := textureImage(wd, ht, func(x, y float64) (float64, float64) { return x, y })
+	img2 := textureImage(wd, ht, func(x, y float64) (float64, float64) { return x - 3.0, y + 2.0 })
+	f, err := EstimateFlow(img1, img2, FlowOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Width != wd || f.Height != ht {
+		t.Fatalf("expected a %dx%d field but saw %dx%d", wd, ht, f.Width, f.Height)
+	}
+	var dxs, dys []float64
+	for y := 16; y < ht-16; y++ {
+		for x := 16; x < wd-16; x++ {
+			dx, dy := f.At(x, y)
+			dxs = append(dxs, float64(dx))
+			dys = append(dys, float64(dy))
+		}
+	}
+	if dx, dy := median(dxs), median(dys); math.Abs(dx-3.0) > 0.1 || math.Abs(dy+2.0) > 0.1 {
+		t.Fatalf("expected a flow of (3, -2) but saw (%.3g, %.3g)", dx, dy)
+	}
+
+	// Invalid arguments should be rejected.
+	if _, err := EstimateFlow(img1, image.NewGray(image.Rect(0, 0, 10, 10)), FlowOptions{}); err == nil {
+		t.Fatal("expected images of different sizes to be rejected")
+	}
+	if _, err := EstimateFlow(img1, img2, FlowOptions{WindowRadius: -1}); err == nil {
+		t.Fatal("expected a negative window radius to be rejected")
+	}
+}
+
+// TestFlowMesh ensures that FlowMesh moves mesh points with the image
+// content while leaving edge points unchanged.
+func TestFlowMesh(t *testing.T) {
+	const wd, ht = 128, 96
+	img1 := textureImage(wd, ht, func(x, y float64) (float64, float64) { return x, y })
+	img2 := textureImage(wd, ht, func(x, y float64) (float64, float64) {
+		// Stretch the image horizontally about its center.
+		return 64.0 + (x-64.0)/1.05, y
+	})
+	src := NewRegularMesh(6, 5, wd, ht)
+	defer src.Free()
+	dst, err := FlowMesh(img1, img2, src, FlowOptions{
+		Smooth: SmoothOptions{Iterations: 2, Strength: 0.3},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Free()
+	if dst.NX != src.NX || dst.NY != src.NY {
+		t.Fatalf("expected a %dx%d mesh but saw %dx%d", src.NX, src.NY, dst.NX, dst.NY)
+	}
+	for r := 0; r < dst.NY; r++ {
+		for c := 0; c < dst.NX; c++ {
+			s, d := src.Get(c, r), dst.Get(c, r)
+			want := Point{X: 64.0 + (s.X-64.0)*1.05, Y: s.Y}
+			if c == 0 || r == 0 || c == dst.NX-1 || r == dst.NY-1 {
+				want = s
+			}
+			if math.Hypot(d.X-want.X, d.Y-want.Y) > 0.5 {
+				t.Fatalf("expected %v at (%d, %d) but saw %v", want, c, r, d)
+			}
+		}
+	}
+	if _, err := FlowMesh(img1, img2, src, FlowOptions{Smooth: SmoothOptions{Iterations: 1}}); err == nil {
+		t.Fatal("expected invalid smoothing options to be rejected")
+	}
+}
@@ -0,0 +1,128 @@
+// This file provides functions that generate destination meshes for common
+// procedural distortions.
+
+package xmorph
+
+import "math"
+
+// DistortionParams specify the parameters of a procedural distortion.  Not
+// every distortion uses every parameter.
+type DistortionParams struct {
+	Center   Point   // Center of the distortion
+	Radius   float64 // Radius of the affected region (wavelength for RippleMesh)
+	Strength float64 // Amount of distortion; see each generator for its meaning
+	Phase    float64 // Phase offset in radians (RippleMesh only)
+}
+
+// distortMesh returns a copy of a mesh with every point transformed by a
+// function.  Edge points are constrained to slide along the image boundary,
+// and corner points do not move.
+func distortMesh(src *Mesh, f func(Point) Point) *Mesh {
+	sp := src.Points()
+	dp := make([][]Point, len(sp))
+	for r, row := range sp {
+		dp[r] = make([]Point, len(row))
+		for c, pt := range row {
+			dp[r][c] = f(pt)
+		}
+	}
+	snapEdges(dp, sp)
+	return MeshFromPoints(dp)
+}
+
+// radialMesh distorts a mesh by moving each point within a given radius of a
+// center point to a new distance, computed by f from the point's original
+// distance normalized to the radius.  f must map [0, 1] to [0, 1] to avoid a
+// discontinuity at the radius.  If rot is non-nil, points are additionally
+// rotated about the center by rot(u) radians.
+func radialMesh(src *Mesh, p DistortionParams, f func(u float64) float64, rot func(u float64) float64) *Mesh {
+	return distortMesh(src, func(pt Point) Point {
+		d := pt.Sub(p.Center)
+		r := math.Hypot(d.X, d.Y)
+		if r == 0.0 || r >= p.Radius || p.Radius <= 0.0 {
+			return pt
+		}
+		u := r / p.Radius
+		theta := math.Atan2(d.Y, d.X)
+		if rot != nil {
+			theta += rot(u)
+		}
+		nr := f(u) * p.Radius
+		s, c := math.Sincos(theta)
+		return Point{X: p.Center.X + nr*c, Y: p.Center.Y + nr*s}
+	})
+}
+
+// SwirlMesh returns a destination mesh that swirls the contents of a circle
+// around its center.  Strength is the rotation in radians at the center,
+// which tapers smoothly to zero at the radius.  Positive strengths rotate
+// clockwise on the screen.
+func SwirlMesh(src *Mesh, p DistortionParams) *Mesh {
+	return radialMesh(src, p,
+		func(u float64) float64 { return u },
+		func(u float64) float64 { return p.Strength * (1.0 - u) * (1.0 - u) })
+}
+
+// FisheyeMesh returns a destination mesh that magnifies the contents of a
+// circle as if viewed through a hemispherical lens.  Strength, in [0, 1],
+// blends between no distortion (0) and a full hemisphere (1).
+func FisheyeMesh(src *Mesh, p DistortionParams) *Mesh {
+	return radialMesh(src, p, func(u float64) float64 {
+		return (1.0-p.Strength)*u + p.Strength*math.Sin(u*math.Pi/2.0)
+	}, nil)
+}
+
+// PinchMesh returns a destination mesh that pulls the contents of a circle
+// towards its center.  Strength should lie in (-3, 1); negative strengths
+// push contents outward (a bulge) instead.
+func PinchMesh(src *Mesh, p DistortionParams) *Mesh {
+	return radialMesh(src, p, func(u float64) float64 {
+		return u * (1.0 - p.Strength*(1.0-u)*(1.0-u))
+	}, nil)
+}
+
+// BarrelMesh returns a destination mesh that applies radial lens distortion
+// to the entire image.  A point at distance r from the center moves to
+// distance r·(1 - Strength·(r/Radius)²).  Positive strengths produce barrel
+// distortion, and negative strengths produce pincushion distortion.  Radius
+// is typically half of the image diagonal.  Because pincushion distortion
+// pushes points outward, its result is scaled towards the center so that
+// no point leaves the image.  Barrel distortion folds the mesh unless
+// 3·Strength·(r/Radius)² < 1 for every mesh point.
+func BarrelMesh(src *Mesh, p DistortionParams) *Mesh {
+	if p.Radius <= 0.0 {
+		return distortMesh(src, func(pt Point) Point { return pt })
+	}
+	factor := func(pt Point) float64 {
+		d := pt.Sub(p.Center)
+		return 1.0 - p.Strength*(d.X*d.X+d.Y*d.Y)/(p.Radius*p.Radius)
+	}
+	norm := 1.0
+	for _, row := range src.Points() {
+		for _, pt := range row {
+			norm = math.Max(norm, factor(pt))
+		}
+	}
+	return distortMesh(src, func(pt Point) Point {
+		return p.Center.Add(pt.Sub(p.Center).Mul(factor(pt) / norm))
+	})
+}
+
+// RippleMesh returns a destination mesh that displaces points radially in
+// concentric waves about the center, like ripples on a pond.  Radius is the
+// wavelength, Strength is the amplitude in pixels, and Phase shifts the
+// waves outward.  Within one wavelength of the center the amplitude tapers
+// to zero.  To avoid fold-overs, Strength should be less than
+// Radius/(2π).
+func RippleMesh(src *Mesh, p DistortionParams) *Mesh {
+	return distortMesh(src, func(pt Point) Point {
+		d := pt.Sub(p.Center)
+		r := math.Hypot(d.X, d.Y)
+		if r == 0.0 || p.Radius <= 0.0 {
+			return pt
+		}
+		amp := p.Strength * math.Min(r/p.Radius, 1.0)
+		dr := amp * math.Sin(2.0*math.Pi*r/p.Radius-p.Phase)
+		return pt.Add(d.Mul(dr / r))
+	})
+}
@@ -0,0 +1,143 @@
+// The functions defined in this file ensure the xmorph package's procedural
+// mesh generators work as expected.
+
+package xmorph
+
+import (
+	"math"
+	"testing"
+)
+
+// distFrom returns the distance between two points.
+func distFrom(p, q Point) float64 {
+	return math.Hypot(p.X-q.X, p.Y-q.Y)
+}
+
+// TestGeneratorsValid ensures that each generator produces a valid mesh with
+// moderate parameters.
+func TestGeneratorsValid(t *testing.T) {
+	const nx, ny, wd, ht = 21, 17, 400, 300
+	src := NewRegularMesh(nx, ny, wd, ht)
+	defer src.Free()
+	c := Point{X: 200, Y: 150}
+	gens := map[string]struct {
+		f func(*Mesh, DistortionParams) *Mesh
+		p DistortionParams
+	}{
+		"Swirl":      {SwirlMesh, DistortionParams{Center: c, Radius: 120, Strength: 1.0}},
+		"Fisheye":    {FisheyeMesh, DistortionParams{Center: c, Radius: 120, Strength: 0.8}},
+		"Pinch":      {PinchMesh, DistortionParams{Center: c, Radius: 120, Strength: 0.6}},
+		"Bulge":      {PinchMesh, DistortionParams{Center: c, Radius: 120, Strength: -1.0}},
+		"Barrel":     {BarrelMesh, DistortionParams{Center: c, Radius: 250, Strength: 0.2}},
+		"Pincushion": {BarrelMesh, DistortionParams{Center: c, Radius: 250, Strength: -0.2}},
+		"Ripple":     {RippleMesh, DistortionParams{Center: c, Radius: 80, Strength: 6, Phase: 1}},
+	}
+	for name, g := range gens {
+		m := g.f(src, g.p)
+		if m.NX != nx || m.NY != ny {
+			t.Fatalf("%s: expected a %dx%d mesh but saw %dx%d", name, nx, ny, m.NX, m.NY)
+		}
+		if rep := m.Validate(wd, ht); !rep.OK() {
+			t.Fatalf("%s: expected a valid mesh but saw %+v", name, rep)
+		}
+		if d, _ := MaxDisplacement(src, m); d < 1.0 {
+			t.Fatalf("%s: expected the mesh to be distorted", name)
+		}
+		m.Free()
+	}
+}
+
+// TestGeneratorsRadial ensures that the radial generators move points in the
+// expected directions and leave points beyond the radius alone.
+func TestGeneratorsRadial(t *testing.T) {
+	const nx, ny, wd, ht = 11, 11, 201, 201
+	src := NewRegularMesh(nx, ny, wd, ht)
+	defer src.Free()
+	p := DistortionParams{Center: Point{X: 100, Y: 100}, Radius: 70, Strength: 0.5}
+	swirl := SwirlMesh(src, p)
+	defer swirl.Free()
+	fish := FisheyeMesh(src, p)
+	defer fish.Free()
+	pinch := PinchMesh(src, p)
+	defer pinch.Free()
+	bp := DistortionParams{Center: p.Center, Radius: 150, Strength: 0.2}
+	barrel := BarrelMesh(src, bp)
+	defer barrel.Free()
+	for r := 0; r < ny; r++ {
+		for c := 0; c < nx; c++ {
+			sp := src.Get(c, r)
+			d := distFrom(sp, p.Center)
+			inside := d > 0.0 && d < p.Radius
+			if q := swirl.Get(c, r); math.Abs(distFrom(q, p.Center)-d) > 1e-9 || inside == sp.Eq(q, 1e-9) {
+				t.Fatalf("unexpected swirl of %v to %v", sp, q)
+			}
+			if q := fish.Get(c, r); inside != (distFrom(q, p.Center) > d+1e-9) {
+				t.Fatalf("unexpected fisheye distortion of %v to %v", sp, q)
+			}
+			if q := pinch.Get(c, r); inside != (distFrom(q, p.Center) < d-1e-9) {
+				t.Fatalf("unexpected pinch of %v to %v", sp, q)
+			}
+			if q := barrel.Get(c, r); r > 0 && c > 0 && r < ny-1 && c < nx-1 {
+				want := d * (1.0 - bp.Strength*d*d/(bp.Radius*bp.Radius))
+				if got := distFrom(q, p.Center); math.Abs(got-want) > 1e-9 {
+					t.Fatalf("expected barrel distortion to move %v to distance %v but saw %v", sp, want, got)
+				}
+			}
+		}
+	}
+
+	// Corners should never move, and edges should slide along the
+	// boundary.
+	for _, cr := range [][2]int{{0, 0}, {nx - 1, 0}, {0, ny - 1}, {nx - 1, ny - 1}} {
+		if p, q := src.Get(cr[0], cr[1]), barrel.Get(cr[0], cr[1]); !p.Eq(q, 1e-9) {
+			t.Fatalf("expected corner %v not to move but saw %v", p, q)
+		}
+	}
+	if q := barrel.Get(2, 0); q.Y != 0.0 || q.X == src.Get(2, 0).X {
+		t.Fatalf("expected top-edge point to slide along the edge but saw %v", q)
+	}
+
+	// Pincushion distortion should be scaled so no point moves outward.
+	bp.Strength = -0.2
+	pin := BarrelMesh(src, bp)
+	defer pin.Free()
+	for r := 1; r < ny-1; r++ {
+		for c := 1; c < nx-1; c++ {
+			sp, q := src.Get(c, r), pin.Get(c, r)
+			if distFrom(q, p.Center) > distFrom(sp, p.Center)+1e-9 {
+				t.Fatalf("expected pincushion distortion not to move %v outward but saw %v", sp, q)
+			}
+		}
+	}
+}
+
+// TestRippleMesh ensures that RippleMesh displaces points radially by the
+// expected amount.
+func TestRippleMesh(t *testing.T) {
+	const nx, ny, wd, ht = 9, 9, 161, 161
+	src := NewRegularMesh(nx, ny, wd, ht)
+	defer src.Free()
+	p := DistortionParams{Center: Point{X: 80, Y: 80}, Radius: 30, Strength: 3, Phase: 0.5}
+	m := RippleMesh(src, p)
+	defer m.Free()
+	for r := 1; r < ny-1; r++ {
+		for c := 1; c < nx-1; c++ {
+			sp, q := src.Get(c, r), m.Get(c, r)
+			d := distFrom(sp, p.Center)
+			if d == 0.0 {
+				if !q.Eq(sp, 1e-9) {
+					t.Fatalf("expected the center not to move but saw %v", q)
+				}
+				continue
+			}
+			amp := p.Strength * math.Min(d/p.Radius, 1.0)
+			want := d + amp*math.Sin(2.0*math.Pi*d/p.Radius-p.Phase)
+			if got := distFrom(q, p.Center); math.Abs(got-want) > 1e-9 {
+				t.Fatalf("expected %v to move to distance %v but saw %v", sp, want, got)
+			}
+			if cr := cross(p.Center, sp, q); math.Abs(cr) > 1e-6 {
+				t.Fatalf("expected %v to move radially but saw %v", sp, q)
+			}
+		}
+	}
+}
@@ -0,0 +1,239 @@
+// This file provides an undo/redo history for mesh edits.
+
+package xmorph
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// A meshState is a snapshot of all of a mesh's points and labels.
+type meshState struct {
+	pts    [][]Point
+	labels [][]int
+}
+
+// A meshEdit records a single change to a mesh.  Edits to individual points
+// record only the point's coordinates or label; edits that may affect the
+// entire mesh record snapshots of the mesh before and after the change.
+type meshEdit struct {
+	x, y          int        // Column and row of an edited point
+	before, after Point      // Point coordinates before and after the edit
+	label         bool       // true = the edit changes the point's label instead
+	oldLbl        int        // Point label before the edit
+	newLbl        int        // Point label after the edit
+	whole         bool       // true = the edit affects the entire mesh
+	prev, next    *meshState // Whole-mesh state before and after the edit
+}
+
+// A meshHistory records the edits made to a mesh.  Each undo or redo step is
+// a list of edits that are undone or redone together.
+type meshHistory struct {
+	limit int          // Maximum number of undo steps (0 = unlimited)
+	undo  [][]meshEdit // Steps that can be undone, oldest first
+	redo  [][]meshEdit // Steps that can be redone, most recently undone last
+	open  []meshEdit   // Edits made during the current transaction
+}
+
+// EnableHistory begins recording edits made by Set, SetImagePoint, SetLabel,
+// AddLine, DeleteLine, Scale, and Functionalize (and by other methods that
+// use those) so they can be reverted with Undo and Redo.  At most limit steps
+// are retained; a limit of 0 retains all steps.  Enabling history on a mesh
+// that already records it only changes the limit.  EnableHistory panics if a
+// transaction is open.
+func (m *Mesh) EnableHistory(limit int) {
+	if limit < 0 {
+		panic("history limit must be non-negative")
+	}
+	if m.depth > 0 {
+		panic("EnableHistory called within a transaction")
+	}
+	if m.hist == nil {
+		m.hist = &meshHistory{}
+	}
+	m.hist.limit = limit
+	m.hist.trim()
+}
+
+// DisableHistory stops recording edits and discards any recorded history.
+// It panics if a transaction is open.
+func (m *Mesh) DisableHistory() {
+	if m.depth > 0 {
+		panic("DisableHistory called within a transaction")
+	}
+	m.hist = nil
+}
+
+// ClearHistory discards all recorded history without disabling recording.
+// It panics if a transaction is open.
+func (m *Mesh) ClearHistory() {
+	if m.depth > 0 {
+		panic("ClearHistory called within a transaction")
+	}
+	if m.hist == nil {
+		return
+	}
+	m.hist.undo = nil
+	m.hist.redo = nil
+}
+
+// BeginTransaction starts grouping edits so that a single Undo or Redo
+// reverts or reapplies all of them.  Transactions can be nested; edits are
+// grouped until the outermost transaction ends.  Transactions are tracked
+// even when history is not enabled, so history cannot be enabled or
+// disabled while one is open.
+func (m *Mesh) BeginTransaction() {
+	m.depth++
+}
+
+// EndTransaction ends a transaction started by BeginTransaction.  It panics
+// if no transaction is open.
+func (m *Mesh) EndTransaction() {
+	if m.depth == 0 {
+		panic("EndTransaction called without a matching BeginTransaction")
+	}
+	m.depth--
+	if h := m.hist; m.depth == 0 && h != nil && len(h.open) > 0 {
+		h.push(h.open)
+		h.open = nil
+	}
+}
+
+// CanUndo reports whether Undo has a step to revert.
+func (m *Mesh) CanUndo() bool {
+	return m.hist != nil && m.depth == 0 && len(m.hist.undo) > 0
+}
+
+// CanRedo reports whether Redo has a step to reapply.
+func (m *Mesh) CanRedo() bool {
+	return m.hist != nil && m.depth == 0 && len(m.hist.redo) > 0
+}
+
+// Undo reverts the most recent step (a single edit or a transaction).  It
+// returns an error if history is not enabled, if a transaction is open, or
+// if there is nothing to undo.
+func (m *Mesh) Undo() error {
+	switch {
+	case m.hist == nil:
+		return fmt.Errorf("mesh history is not enabled")
+	case m.depth > 0:
+		return fmt.Errorf("cannot undo within a transaction")
+	case len(m.hist.undo) == 0:
+		return fmt.Errorf("nothing to undo")
+	}
+	h := m.hist
+	step := h.undo[len(h.undo)-1]
+	h.undo = h.undo[:len(h.undo)-1]
+	for i := len(step) - 1; i >= 0; i-- {
+		switch e := step[i]; {
+		case e.whole:
+			m.restore(e.prev)
+		case e.label:
+			m.setLabel(e.x, e.y, e.oldLbl)
+		default:
+			m.setPoint(e.x, e.y, e.before)
+		}
+	}
+	h.redo = append(h.redo, step)
+	return nil
+}
+
+// Redo reapplies the most recently undone step.  It returns an error if
+// history is not enabled, if a transaction is open, or if there is nothing
+// to redo.  Any edit made after an Undo discards the steps that could have
+// been redone.
+func (m *Mesh) Redo() error {
+	switch {
+	case m.hist == nil:
+		return fmt.Errorf("mesh history is not enabled")
+	case m.depth > 0:
+		return fmt.Errorf("cannot redo within a transaction")
+	case len(m.hist.redo) == 0:
+		return fmt.Errorf("nothing to redo")
+	}
+	h := m.hist
+	step := h.redo[len(h.redo)-1]
+	h.redo = h.redo[:len(h.redo)-1]
+	for _, e := range step {
+		switch {
+		case e.whole:
+			m.restore(e.next)
+		case e.label:
+			m.setLabel(e.x, e.y, e.newLbl)
+		default:
+			m.setPoint(e.x, e.y, e.after)
+		}
+	}
+	h.undo = append(h.undo, step)
+	return nil
+}
+
+// push appends a step to the undo list, discards any steps that could have
+// been redone, and enforces the history limit.
+func (h *meshHistory) push(step []meshEdit) {
+	h.undo = append(h.undo, step)
+	h.redo = nil
+	h.trim()
+}
+
+// trim discards the oldest undo steps in excess of the history limit.
+func (h *meshHistory) trim() {
+	if h.limit > 0 && len(h.undo) > h.limit {
+		h.undo = append([][]meshEdit(nil), h.undo[len(h.undo)-h.limit:]...)
+	}
+}
+
+// record adds an edit to the current transaction or, if no transaction is
+// open, records it as a step of its own.
+func (m *Mesh) record(e meshEdit) {
+	h := m.hist
+	if m.depth > 0 {
+		h.open = append(h.open, e)
+		return
+	}
+	h.push([]meshEdit{e})
+}
+
+// recordPoint records an impending change to the point at (x, y).
+func (m *Mesh) recordPoint(x, y int, pt Point) {
+	m.record(meshEdit{x: x, y: y, before: m.Get(x, y), after: pt})
+}
+
+// recordLabel records an impending change to the label of the point at
+// (x, y).
+func (m *Mesh) recordLabel(x, y, label int) {
+	m.record(meshEdit{x: x, y: y, label: true, oldLbl: m.GetLabel(x, y), newLbl: label})
+}
+
+// snapshot returns the mesh's current state if history is enabled and nil
+// otherwise.
+func (m *Mesh) snapshot() *meshState {
+	if m.hist == nil {
+		return nil
+	}
+	return &meshState{pts: m.Points(), labels: m.meshLabels()}
+}
+
+// recordState records a whole-mesh edit, given a snapshot of the mesh
+// before the edit was made.  It does nothing if prev is nil or if the edit
+// left the mesh unchanged.
+func (m *Mesh) recordState(prev *meshState) {
+	if prev == nil || m.hist == nil {
+		return
+	}
+	next := m.snapshot()
+	if reflect.DeepEqual(prev, next) {
+		return
+	}
+	m.record(meshEdit{whole: true, prev: prev, next: next})
+}
+
+// restore replaces the mesh's contents, including its dimensions, with a
+// snapshot.
+func (m *Mesh) restore(s *meshState) {
+	nm := meshFromGrid(s.pts, s.labels)
+	m.mesh, nm.mesh = nm.mesh, m.mesh
+	m.NX, m.NY = nm.NX, nm.NY
+	m.index = nil
+	nm.Free()
+}
@@ -0,0 +1,290 @@
+// The functions defined in this file ensure the xmorph package's edit
+// history works as expected.
+
+package xmorph
+
+import (
+	"image"
+	"math/rand"
+	"testing"
+)
+
+// sameMesh reports whether two meshes have the same dimensions, points, and
+// labels.
+func sameMesh(a, b *Mesh) bool {
+	if a.NX != b.NX || a.NY != b.NY {
+		return false
+	}
+	for r := 0; r < a.NY; r++ {
+		for c := 0; c < a.NX; c++ {
+			if a.Get(c, r) != b.Get(c, r) || a.GetLabel(c, r) != b.GetLabel(c, r) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// TestHistoryDisabled ensures that Undo and Redo fail when history is not
+// enabled.
+func TestHistoryDisabled(t *testing.T) {
+	m := NewRegularMesh(4, 4, 30, 30)
+	defer m.Free()
+	m.Set(1, 1, Point{X: 5, Y: 5})
+	if m.CanUndo() || m.CanRedo() {
+		t.Fatal("expected nothing to undo or redo")
+	}
+	if err := m.Undo(); err == nil {
+		t.Fatal("expected Undo to fail without history")
+	}
+	if err := m.Redo(); err == nil {
+		t.Fatal("expected Redo to fail without history")
+	}
+	m.BeginTransaction()
+	m.EndTransaction()
+}
+
+// TestHistorySet ensures that point edits can be undone and redone.
+func TestHistorySet(t *testing.T) {
+	m := NewRegularMesh(4, 4, 30, 30)
+	defer m.Free()
+	orig := MeshFromPoints(m.Points())
+	defer orig.Free()
+	m.EnableHistory(0)
+	m.Set(1, 1, Point{X: 5, Y: 6})
+	m.SetImagePoint(2, 1, image.Point{X: 21, Y: 8})
+	m.Set(1, 1, Point{X: 7, Y: 8})
+	edited := MeshFromPoints(m.Points())
+	defer edited.Free()
+
+	// Undo everything.
+	for i := 0; i < 3; i++ {
+		if !m.CanUndo() {
+			t.Fatalf("expected to be able to undo step %d", i+1)
+		}
+		if err := m.Undo(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !sameMesh(m, orig) {
+		t.Fatalf("expected %v but saw %v", orig, m)
+	}
+	if err := m.Undo(); err == nil {
+		t.Fatal("expected Undo to fail with nothing to undo")
+	}
+
+	// Redo everything.
+	for i := 0; i < 3; i++ {
+		if err := m.Redo(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !sameMesh(m, edited) {
+		t.Fatalf("expected %v but saw %v", edited, m)
+	}
+	if err := m.Redo(); err == nil {
+		t.Fatal("expected Redo to fail with nothing to redo")
+	}
+
+	// A new edit after an undo discards the redo list.
+	if err := m.Undo(); err != nil {
+		t.Fatal(err)
+	}
+	m.Set(2, 2, Point{X: 15, Y: 15})
+	if m.CanRedo() {
+		t.Fatal("expected a new edit to discard the redo list")
+	}
+}
+
+// TestHistoryWholeMesh ensures that operations that affect the entire mesh,
+// including those that change its dimensions, can be undone and redone.
+func TestHistoryWholeMesh(t *testing.T) {
+	m := NewRegularMesh(5, 5, 40, 40)
+	defer m.Free()
+	m.SetLabel(2, 2, 9)
+	m.EnableHistory(0)
+	states := []*Mesh{MeshFromPoints(m.Points())}
+	states[0].SetLabel(2, 2, 9)
+	save := func() {
+		s := MeshFromPoints(m.Points())
+		for r := 0; r < m.NY; r++ {
+			for c := 0; c < m.NX; c++ {
+				s.SetLabel(c, r, m.GetLabel(c, r))
+			}
+		}
+		states = append(states, s)
+	}
+	if err := m.AddLine(1, 0.5, Vertical); err != nil {
+		t.Fatal(err)
+	}
+	save()
+	if err := m.DeleteLine(1, Horizontal); err != nil {
+		t.Fatal(err)
+	}
+	save()
+	m.Scale(80, 60)
+	save()
+	m.Set(3, 1, Point{X: -10, Y: 100})
+	m.Functionalize(80, 60)
+	save()
+	defer func() {
+		for _, s := range states {
+			s.Free()
+		}
+	}()
+
+	// Undo back to the beginning, checking each state along the way.
+	// Set and Functionalize were recorded as separate steps.
+	for i := len(states) - 2; i >= 0; i-- {
+		if err := m.Undo(); err != nil {
+			t.Fatal(err)
+		}
+		if i == len(states)-2 {
+			if err := m.Undo(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if !sameMesh(m, states[i]) {
+			t.Fatalf("expected state %d, %v, but saw %v", i, states[i], m)
+		}
+	}
+
+	// Redo everything.
+	for m.CanRedo() {
+		if err := m.Redo(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !sameMesh(m, states[len(states)-1]) {
+		t.Fatalf("expected %v but saw %v", states[len(states)-1], m)
+	}
+}
+
+// TestHistoryTransactions ensures that transactions group edits into a
+// single step and that the history limit is enforced.
+func TestHistoryTransactions(t *testing.T) {
+	rng := rand.New(rand.NewSource(45))
+	m := jaggedMesh(rng, 6, 5, 100, 80, 0.3)
+	defer m.Free()
+	orig := MeshFromPoints(m.Points())
+	defer orig.Free()
+	m.EnableHistory(0)
+
+	// Nested transactions form a single step.
+	m.BeginTransaction()
+	m.Set(1, 1, Point{X: 12, Y: 13})
+	m.BeginTransaction()
+	m.Set(2, 2, Point{X: 40, Y: 30})
+	m.EndTransaction()
+	if err := m.Undo(); err == nil {
+		t.Fatal("expected Undo to fail within a transaction")
+	}
+	m.Transform(NewTranslation(1, 2), true)
+	m.EndTransaction()
+	if err := m.Undo(); err != nil {
+		t.Fatal(err)
+	}
+	if !sameMesh(m, orig) {
+		t.Fatalf("expected %v but saw %v", orig, m)
+	}
+	if m.CanUndo() {
+		t.Fatal("expected the transaction to be a single step")
+	}
+
+	// Transform and smoothing are each recorded as a single step.
+	m.Transform(NewTranslation(1, 2), true)
+	if err := m.SmoothLaplacian(SmoothOptions{Iterations: 3, Strength: 0.5}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := m.Undo(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !sameMesh(m, orig) || m.CanUndo() {
+		t.Fatal("expected Transform and SmoothLaplacian each to be a single step")
+	}
+
+	// Only the most recent steps are retained.
+	m.EnableHistory(2)
+	for i := 0; i < 5; i++ {
+		m.Set(1, 1, Point{X: float64(10 + i), Y: 10})
+	}
+	n := 0
+	for m.CanUndo() {
+		if err := m.Undo(); err != nil {
+			t.Fatal(err)
+		}
+		n++
+	}
+	if n != 2 {
+		t.Fatalf("expected 2 steps to be retained but saw %d", n)
+	}
+	if p := m.Get(1, 1); p.X != 12 {
+		t.Fatalf("expected (12, 10) but saw %v", p)
+	}
+
+	// Disabling history discards it.
+	m.DisableHistory()
+	if m.CanRedo() {
+		t.Fatal("expected DisableHistory to discard history")
+	}
+}
+
+// TestHistoryLabels ensures that label edits can be undone and redone and
+// that edits that change nothing are not recorded.
+func TestHistoryLabels(t *testing.T) {
+	m := NewRegularMesh(5, 5, 40, 40)
+	defer m.Free()
+	m.EnableHistory(0)
+	m.SetLabel(2, 3, 7)
+	m.SetLabel(2, 3, 7)
+	m.Scale(40, 40)
+	if err := m.Undo(); err != nil {
+		t.Fatal(err)
+	}
+	if lbl := m.GetLabel(2, 3); lbl != 0 {
+		t.Fatalf("expected label 0 but saw %d", lbl)
+	}
+	if m.CanUndo() {
+		t.Fatal("expected an unchanged label and a no-op Scale not to be recorded")
+	}
+	if err := m.Redo(); err != nil {
+		t.Fatal(err)
+	}
+	if lbl := m.GetLabel(2, 3); lbl != 7 {
+		t.Fatalf("expected label 7 but saw %d", lbl)
+	}
+}
+
+// panics reports whether a function panics.
+func panics(f func()) (p bool) {
+	defer func() { p = recover() != nil }()
+	f()
+	return false
+}
+
+// TestHistoryToggleInTransaction ensures that history cannot be enabled or
+// disabled within a transaction, even one begun while history was disabled.
+func TestHistoryToggleInTransaction(t *testing.T) {
+	m := NewRegularMesh(4, 4, 30, 30)
+	defer m.Free()
+	m.BeginTransaction()
+	if !panics(func() { m.EnableHistory(0) }) {
+		t.Fatal("expected EnableHistory to panic within a transaction")
+	}
+	m.EndTransaction()
+	m.EnableHistory(0)
+	m.BeginTransaction()
+	m.Set(1, 1, Point{X: 5, Y: 5})
+	if !panics(func() { m.DisableHistory() }) {
+		t.Fatal("expected DisableHistory to panic within a transaction")
+	}
+	m.EndTransaction()
+	if !m.CanUndo() {
+		t.Fatal("expected the transaction's edit to be recorded")
+	}
+	if !panics(m.EndTransaction) {
+		t.Fatal("expected an unmatched EndTransaction to panic")
+	}
+}
@@ -0,0 +1,304 @@
+// This file provides functions for importing facial landmarks and fitting
+// meshes to them.
+
+package xmorph
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ReadPTS reads a set of landmarks in the iBUG .pts format.
+func ReadPTS(r io.Reader) ([]Point, error) {
+	scanner := bufio.NewScanner(r)
+	np := -1
+	var lms []Point
+	inPoints := false
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		ln := strings.TrimSpace(scanner.Text())
+		switch {
+		case ln == "":
+			continue
+		case !inPoints && strings.HasPrefix(ln, "version:"):
+			continue
+		case !inPoints && strings.HasPrefix(ln, "n_points:"):
+			var err error
+			np, err = strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(ln, "n_points:")))
+			if err != nil || np < 0 {
+				return nil, fmt.Errorf("line %d: invalid point count %q", lineNum, ln)
+			}
+		case !inPoints && ln == "{":
+			inPoints = true
+		case inPoints && ln == "}":
+			if np >= 0 && len(lms) != np {
+				return nil, fmt.Errorf("expected %d landmarks but read %d", np, len(lms))
+			}
+			return lms, nil
+		case inPoints:
+			var pt Point
+			ntoks, err := fmt.Sscan(ln, &pt.X, &pt.Y)
+			if err != nil || ntoks != 2 {
+				return nil, fmt.Errorf("line %d: failed to parse %q as {x, y}", lineNum, ln)
+			}
+			lms = append(lms, pt)
+		default:
+			return nil, fmt.Errorf("line %d: unexpected text %q", lineNum, ln)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("failed to read landmarks (%w)", io.ErrUnexpectedEOF)
+}
+
+// dlibDataset represents the subset of a dlib imglab XML file that describes
+// landmark locations.
+type dlibDataset struct {
+	Images []struct {
+		Boxes []struct {
+			Parts []struct {
+				Name string  `xml:"name,attr"`
+				X    float64 `xml:"x,attr"`
+				Y    float64 `xml:"y,attr"`
+			} `xml:"part"`
+		} `xml:"box"`
+	} `xml:"images>image"`
+}
+
+// latin1Reader converts ISO-8859-1 text, which dlib declares as the encoding
+// of its XML files, to UTF-8.
+func latin1Reader(charset string, r io.Reader) (io.Reader, error) {
+	switch strings.ToLower(charset) {
+	case "iso-8859-1", "latin1", "latin-1":
+	default:
+		return nil, fmt.Errorf("unsupported character set %q", charset)
+	}
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(r); err != nil {
+		return nil, err
+	}
+	var sb strings.Builder
+	for _, b := range buf.Bytes() {
+		sb.WriteRune(rune(b))
+	}
+	return strings.NewReader(sb.String()), nil
+}
+
+// ReadDlibLandmarks reads a set of landmarks (typically dlib's 68-point face
+// landmarks) from the parts of the first box of the first image in a dlib
+// imglab XML file.  Landmarks are returned in order of their numeric part
+// name.
+func ReadDlibLandmarks(r io.Reader) ([]Point, error) {
+	// Parse the XML file.
+	var ds dlibDataset
+	dec := xml.NewDecoder(r)
+	dec.CharsetReader = latin1Reader
+	if err := dec.Decode(&ds); err != nil {
+		return nil, fmt.Errorf("failed to parse dlib XML (%w)", err)
+	}
+	if len(ds.Images) == 0 || len(ds.Images[0].Boxes) == 0 {
+		return nil, fmt.Errorf("dlib XML contains no image boxes")
+	}
+	parts := ds.Images[0].Boxes[0].Parts
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("dlib XML box contains no parts")
+	}
+
+	// Order the landmarks by part number.
+	idx := make([]int, len(parts))
+	for i, p := range parts {
+		n, err := strconv.Atoi(p.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse part name %q as a number (%w)", p.Name, err)
+		}
+		idx[i] = n
+	}
+	order := make([]int, len(parts))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return idx[order[a]] < idx[order[b]] })
+	lms := make([]Point, len(parts))
+	for i, j := range order {
+		lms[i] = Point{X: parts[j].X, Y: parts[j].Y}
+	}
+	return lms, nil
+}
+
+// relaxMesh moves all unpinned mesh points so that their displacements from
+// a set of reference points vary smoothly.  It does this by iteratively
+// replacing each unpinned displacement with the average of its neighbors'
+// displacements until no displacement changes by more than tol or until
+// maxIters iterations have elapsed.  Points along the mesh's edge are
+// implicitly pinned.
+func relaxMesh(pts, ref [][]Point, pinned [][]bool, tol float64, maxIters int) {
+	ny, nx := len(pts), len(pts[0])
+	disp := make([][]Point, ny)
+	for r := range disp {
+		disp[r] = make([]Point, nx)
+		for c := range disp[r] {
+			disp[r][c] = pts[r][c].Sub(ref[r][c])
+		}
+	}
+	for it := 0; it < maxIters; it++ {
+		maxDelta := 0.0
+		for r := 1; r < ny-1; r++ {
+			for c := 1; c < nx-1; c++ {
+				if pinned[r][c] {
+					continue
+				}
+				avg := disp[r-1][c].Add(disp[r+1][c]).Add(disp[r][c-1]).Add(disp[r][c+1]).Div(4.0)
+				delta := math.Max(math.Abs(avg.X-disp[r][c].X), math.Abs(avg.Y-disp[r][c].Y))
+				maxDelta = math.Max(maxDelta, delta)
+				disp[r][c] = avg
+			}
+		}
+		if maxDelta <= tol {
+			break
+		}
+	}
+	for r := range pts {
+		for c := range pts[r] {
+			pts[r][c] = ref[r][c].Add(disp[r][c])
+		}
+	}
+}
+
+// landmarkAssignments maps each interior vertex of a regular mesh to the
+// index of the landmark pinned to it or to -1 if no landmark is pinned there.
+// Landmark–vertex pairs are considered in order of increasing distance, and
+// each landmark is pinned to the nearest interior vertex not already taken
+// by a closer landmark, so no landmark is ever dropped.  landmarkAssignments
+// returns an error if there are more landmarks than interior vertices.
+func landmarkAssignments(reg [][]Point, lms []Point) ([][]int, error) {
+	ny, nx := len(reg), len(reg[0])
+	if n := (nx - 2) * (ny - 2); len(lms) > n {
+		return nil, fmt.Errorf("%d landmarks cannot be pinned to only %d interior mesh vertices", len(lms), n)
+	}
+	asgn := make([][]int, ny)
+	for r := range asgn {
+		asgn[r] = make([]int, nx)
+		for c := range asgn[r] {
+			asgn[r][c] = -1
+		}
+	}
+
+	// Sort all landmark–vertex pairs by distance.
+	type pairing struct {
+		k, r, c int
+		d       float64
+	}
+	pairs := make([]pairing, 0, len(lms)*(nx-2)*(ny-2))
+	for k, lm := range lms {
+		for r := 1; r < ny-1; r++ {
+			for c := 1; c < nx-1; c++ {
+				d := math.Hypot(reg[r][c].X-lm.X, reg[r][c].Y-lm.Y)
+				pairs = append(pairs, pairing{k: k, r: r, c: c, d: d})
+			}
+		}
+	}
+	sort.SliceStable(pairs, func(a, b int) bool { return pairs[a].d < pairs[b].d })
+
+	// Greedily pin each landmark to its nearest free vertex.
+	done := make([]bool, len(lms))
+	for _, p := range pairs {
+		if done[p.k] || asgn[p.r][p.c] != -1 {
+			continue
+		}
+		asgn[p.r][p.c] = p.k
+		done[p.k] = true
+	}
+	return asgn, nil
+}
+
+// FitMeshesToLandmarks fits an nx×ny mesh spanning a wd×ht image to each of
+// a number of sets of corresponding landmarks (e.g., one set per face photo).
+// Each landmark is pinned to a distinct interior mesh vertex—the nearest one
+// not claimed by a closer landmark—chosen consistently across all sets based
+// on the sets' mean landmark positions.  FitMeshesToLandmarks returns an
+// error if there are more landmarks than interior vertices.
+// The remaining interior vertices are relaxed so the mesh deforms smoothly,
+// and the edge vertices remain on the image boundary.  The resulting meshes
+// are mutually compatible and can be passed directly to Morph.
+//
+// Landmarks that are ordered inconsistently (e.g., an eye to the right of a
+// mouth corner in one set but to the left in another) can lead to meshes that
+// fold over; use Mesh.Functionalize to repair these if necessary.
+func FitMeshesToLandmarks(lmSets [][]Point, nx, ny, wd, ht int) ([]*Mesh, error) {
+	// Sanity check our arguments.
+	if nx < 4 || ny < 4 {
+		return nil, fmt.Errorf("mesh must be at least 4x4 (requested %dx%d)", nx, ny)
+	}
+	if len(lmSets) == 0 {
+		return nil, fmt.Errorf("no landmark sets were provided")
+	}
+	nLms := len(lmSets[0])
+	for i, lms := range lmSets {
+		if len(lms) != nLms {
+			return nil, fmt.Errorf("landmark set %d contains %d landmarks, but set 0 contains %d", i, len(lms), nLms)
+		}
+	}
+
+	// Pin landmarks to vertices based on their mean positions.
+	regMesh := NewRegularMesh(nx, ny, wd, ht)
+	reg := regMesh.Points()
+	regMesh.Free()
+	mean := make([]Point, nLms)
+	for _, lms := range lmSets {
+		for k, lm := range lms {
+			mean[k] = mean[k].Add(lm.Div(float64(len(lmSets))))
+		}
+	}
+	asgn, err := landmarkAssignments(reg, mean)
+	if err != nil {
+		return nil, err
+	}
+	pinned := make([][]bool, ny)
+	for r := range pinned {
+		pinned[r] = make([]bool, nx)
+		for c, k := range asgn[r] {
+			pinned[r][c] = k >= 0
+		}
+	}
+
+	// Fit a mesh to each set of landmarks.
+	meshes := make([]*Mesh, len(lmSets))
+	for i, lms := range lmSets {
+		pts := make([][]Point, ny)
+		for r := range pts {
+			pts[r] = make([]Point, nx)
+			for c := range pts[r] {
+				if k := asgn[r][c]; k >= 0 {
+					pts[r][c] = lms[k]
+				} else {
+					pts[r][c] = reg[r][c]
+				}
+			}
+		}
+		relaxMesh(pts, reg, pinned, 1e-4, 10*nx*ny)
+		meshes[i] = MeshFromPoints(pts)
+	}
+	return meshes, nil
+}
+
+// FitMeshToLandmarks fits an nx×ny mesh spanning a wd×ht image to a single set
+// of landmarks.  See FitMeshesToLandmarks for details.  Note that meshes fit
+// individually to different landmark sets are compatible in size but not
+// necessarily in which vertices are pinned; prefer FitMeshesToLandmarks when
+// preparing meshes for morphing.
+func FitMeshToLandmarks(lms []Point, nx, ny, wd, ht int) (*Mesh, error) {
+	meshes, err := FitMeshesToLandmarks([][]Point{lms}, nx, ny, wd, ht)
+	if err != nil {
+		return nil, err
+	}
+	return meshes[0], nil
+}
@@ -0,0 +1,179 @@
+// The functions defined in this file ensure the xmorph package's landmark
+// operations work as expected.
+
+package xmorph
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+// TestReadPTS ensures we can read an iBUG .pts file.
+func TestReadPTS(t *testing.T) {
+	ptsStr := `version: 1
+n_points:  3
+{
+100.5 200.25
+150 210
+125.75 260
+}
+`
+	lms, err := ReadPTS(strings.NewReader(ptsStr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Point{{100.5, 200.25}, {150, 210}, {125.75, 260}}
+	if len(lms) != len(expected) {
+		t.Fatalf("expected %d landmarks but saw %d", len(expected), len(lms))
+	}
+	for i, pt := range expected {
+		if lms[i] != pt {
+			t.Fatalf("expected landmark %d to be %v but saw %v", i, pt, lms[i])
+		}
+	}
+
+	// Ensure that point-count mismatches and truncated files are rejected.
+	bad := []string{
+		strings.Replace(ptsStr, "n_points:  3", "n_points:  4", 1),
+		strings.Replace(ptsStr, "}\n", "", 1),
+		strings.Replace(ptsStr, "150 210", "150", 1),
+	}
+	for _, b := range bad {
+		if _, err = ReadPTS(strings.NewReader(b)); err == nil {
+			t.Fatalf("expected an error when reading %q", b)
+		}
+	}
+}
+
+// TestReadDlibLandmarks ensures we can read landmarks from a dlib imglab XML
+// file.
+func TestReadDlibLandmarks(t *testing.T) {
+	xmlStr := `<?xml version='1.0' encoding='ISO-8859-1'?>
+<dataset>
+<name>Faces</name>
+<images>
+  <image file='face.jpg'>
+    <box top='10' left='20' width='100' height='100'>
+      <part name='02' x='60' y='70'/>
+      <part name='00' x='30' y='40'/>
+      <part name='01' x='90' y='41'/>
+    </box>
+  </image>
+</images>
+</dataset>
+`
+	lms, err := ReadDlibLandmarks(strings.NewReader(xmlStr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Point{{30, 40}, {90, 41}, {60, 70}}
+	if len(lms) != len(expected) {
+		t.Fatalf("expected %d landmarks but saw %d", len(expected), len(lms))
+	}
+	for i, pt := range expected {
+		if lms[i] != pt {
+			t.Fatalf("expected landmark %d to be %v but saw %v", i, pt, lms[i])
+		}
+	}
+}
+
+// TestFitMeshesToLandmarks ensures that meshes fit to landmarks pin the
+// landmarks, keep their edges on the image boundary, and are mutually
+// compatible.
+func TestFitMeshesToLandmarks(t *testing.T) {
+	const nx, ny, wd, ht = 9, 9, 161, 161
+	lms1 := []Point{{55, 60}, {105, 62}, {80, 90}, {60, 120}, {100, 118}}
+	lms2 := []Point{{50, 65}, {110, 60}, {82, 95}, {64, 115}, {98, 125}}
+	meshes, err := FitMeshesToLandmarks([][]Point{lms1, lms2}, nx, ny, wd, ht)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg := NewRegularMesh(nx, ny, wd, ht)
+	defer reg.Free()
+	regPts := reg.Points()
+	for i, lms := range [][]Point{lms1, lms2} {
+		m := meshes[i]
+		validateMeshDimens(t, m, nx, ny)
+		pts := m.Points()
+
+		// Ensure every landmark appears in the mesh.
+		for _, lm := range lms {
+			found := false
+			for _, row := range pts {
+				for _, pt := range row {
+					if pt == lm {
+						found = true
+					}
+				}
+			}
+			if !found {
+				t.Fatalf("landmark %v does not appear in mesh %d", lm, i)
+			}
+		}
+
+		// Ensure the edges are unmodified.
+		for r := 0; r < ny; r++ {
+			for c := 0; c < nx; c++ {
+				if r != 0 && c != 0 && r != ny-1 && c != nx-1 {
+					continue
+				}
+				if pts[r][c] != regPts[r][c] {
+					t.Fatalf("edge point (%d, %d) moved from %v to %v", c, r, regPts[r][c], pts[r][c])
+				}
+			}
+		}
+		m.Free()
+	}
+}
+
+// TestFitMeshToLandmarksIdentity ensures that landmarks lying on a regular
+// mesh's vertices produce the regular mesh.
+func TestFitMeshToLandmarksIdentity(t *testing.T) {
+	const nx, ny, wd, ht = 6, 5, 101, 81
+	reg := NewRegularMesh(nx, ny, wd, ht)
+	defer reg.Free()
+	lms := []Point{reg.Get(1, 1), reg.Get(3, 2), reg.Get(4, 3)}
+	m, err := FitMeshToLandmarks(lms, nx, ny, wd, ht)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Free()
+	for r := 0; r < ny; r++ {
+		for c := 0; c < nx; c++ {
+			p, q := reg.Get(c, r), m.Get(c, r)
+			if math.Abs(p.X-q.X) > 1e-3 || math.Abs(p.Y-q.Y) > 1e-3 {
+				t.Fatalf("expected (%d, %d) to be %v but saw %v", c, r, p, q)
+			}
+		}
+	}
+}
+
+// TestFitMeshToLandmarksCrowded ensures that landmarks sharing a nearest
+// vertex are all pinned and that too many landmarks are rejected.
+func TestFitMeshToLandmarksCrowded(t *testing.T) {
+	const nx, ny, wd, ht = 6, 6, 101, 101
+	lms := []Point{{X: 40, Y: 40}, {X: 41, Y: 42}, {X: 43, Y: 39}, {X: 38, Y: 41}}
+	m, err := FitMeshToLandmarks(lms, nx, ny, wd, ht)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Free()
+	pts := m.Points()
+	for _, lm := range lms {
+		found := false
+		for _, row := range pts {
+			for _, pt := range row {
+				if pt == lm {
+					found = true
+				}
+			}
+		}
+		if !found {
+			t.Fatalf("landmark %v does not appear in the mesh", lm)
+		}
+	}
+	if _, err := FitMeshToLandmarks(make([]Point, 17), nx, ny, wd, ht); err == nil {
+		t.Fatal("expected more landmarks than interior vertices to be rejected")
+	}
+}
@@ -0,0 +1,106 @@
+// This file provides functions for correcting (or simulating) camera lens
+// distortion using the Brown–Conrady model.
+
+package xmorph
+
+import (
+	"fmt"
+	"math"
+)
+
+// CameraIntrinsics describe a pinhole camera's focal lengths and principal
+// point in pixels, as in the first two rows of OpenCV's camera matrix.
+type CameraIntrinsics struct {
+	FX, FY float64 // Focal lengths
+	CX, CY float64 // Principal point
+}
+
+// LensDistortion holds Brown–Conrady distortion coefficients using OpenCV's
+// conventions: K1, K2, and K3 are radial coefficients, and P1 and P2 are
+// tangential coefficients.
+type LensDistortion struct {
+	K1, K2, P1, P2, K3 float64
+}
+
+// distortNormalized applies lens distortion to a point in normalized camera
+// coordinates.
+func (ld LensDistortion) distortNormalized(p Point) Point {
+	x, y := p.X, p.Y
+	r2 := x*x + y*y
+	radial := 1.0 + r2*(ld.K1+r2*(ld.K2+r2*ld.K3))
+	return Point{
+		X: x*radial + 2.0*ld.P1*x*y + ld.P2*(r2+2.0*x*x),
+		Y: y*radial + ld.P1*(r2+2.0*y*y) + 2.0*ld.P2*x*y,
+	}
+}
+
+// Distort maps a point in an ideal, undistorted image to the corresponding
+// point in the image captured through the distorting lens.
+func (cam CameraIntrinsics) Distort(p Point, ld LensDistortion) Point {
+	n := Point{X: (p.X - cam.CX) / cam.FX, Y: (p.Y - cam.CY) / cam.FY}
+	d := ld.distortNormalized(n)
+	return Point{X: d.X*cam.FX + cam.CX, Y: d.Y*cam.FY + cam.CY}
+}
+
+// Undistort maps a point in the image captured through the distorting lens to
+// the corresponding point in an ideal, undistorted image.  It inverts
+// Distort numerically using Newton's method.
+func (cam CameraIntrinsics) Undistort(p Point, ld LensDistortion) Point {
+	target := Point{X: (p.X - cam.CX) / cam.FX, Y: (p.Y - cam.CY) / cam.FY}
+	n := target
+	const h = 1e-7
+	for iter := 0; iter < 50; iter++ {
+		// Compute the residual and a finite-difference Jacobian.
+		f := ld.distortNormalized(n).Sub(target)
+		if math.Abs(f.X) < 1e-14 && math.Abs(f.Y) < 1e-14 {
+			break
+		}
+		fx := ld.distortNormalized(Point{X: n.X + h, Y: n.Y}).Sub(target).Sub(f).Div(h)
+		fy := ld.distortNormalized(Point{X: n.X, Y: n.Y + h}).Sub(target).Sub(f).Div(h)
+		det := fx.X*fy.Y - fy.X*fx.Y
+		if math.Abs(det) < 1e-300 {
+			break
+		}
+
+		// Take a Newton step.
+		n.X -= (fy.Y*f.X - fy.X*f.Y) / det
+		n.Y -= (fx.X*f.Y - fx.Y*f.X) / det
+	}
+	return Point{X: n.X*cam.FX + cam.CX, Y: n.Y*cam.FY + cam.CY}
+}
+
+// NewLensMeshes returns a compatible pair of nx×ny meshes that, when passed
+// to Warp, correct the lens distortion of a wd×ht image taken with a given
+// camera.  If distort is true, the meshes instead simulate the distortion,
+// transforming an ideal image into one that appears to have been captured
+// through the lens.
+//
+// The destination mesh is regular, and each source mesh point is the
+// location in the input image that should appear at the corresponding
+// destination point.  Because libmorph requires mesh edges to lie on the
+// image boundary, source points on the mesh's outer rows and columns are
+// moved to the boundary, so the correction is exact only in the interior.
+// Denser meshes reproduce the lens model more faithfully.
+func NewLensMeshes(cam CameraIntrinsics, ld LensDistortion, nx, ny, wd, ht int, distort bool) (*Mesh, *Mesh, error) {
+	if nx < 4 || ny < 4 {
+		return nil, nil, fmt.Errorf("mesh must be at least 4x4 (requested %dx%d)", nx, ny)
+	}
+	if cam.FX == 0.0 || cam.FY == 0.0 {
+		return nil, nil, fmt.Errorf("camera focal lengths must be nonzero")
+	}
+	dst := NewRegularMesh(nx, ny, wd, ht)
+	dp := dst.Points()
+	sp := make([][]Point, ny)
+	for r, row := range dp {
+		sp[r] = make([]Point, nx)
+		for c, pt := range row {
+			if distort {
+				sp[r][c] = cam.Undistort(pt, ld)
+			} else {
+				sp[r][c] = cam.Distort(pt, ld)
+			}
+		}
+	}
+	snapEdges(sp, dp)
+	return MeshFromPoints(sp), dst, nil
+}
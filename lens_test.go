@@ -0,0 +1,103 @@
+// The functions defined in this file ensure the xmorph package's lens
+// distortion operations work as expected.
+
+package xmorph
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// TestLensDistort ensures that Distort agrees with analytically computed
+// values of the Brown–Conrady model.
+func TestLensDistort(t *testing.T) {
+	cam := CameraIntrinsics{FX: 100, FY: 100, CX: 50, CY: 50}
+	tests := []struct {
+		ld   LensDistortion
+		p, q Point
+	}{
+		// No distortion
+		{LensDistortion{}, Point{X: 123, Y: 45}, Point{X: 123, Y: 45}},
+
+		// Principal point is fixed
+		{LensDistortion{K1: 0.3, K2: 0.1, P1: 0.01, P2: 0.02, K3: 0.05}, Point{X: 50, Y: 50}, Point{X: 50, Y: 50}},
+
+		// x = 1, y = 0: radial factor 1 + 0.1 = 1.1
+		{LensDistortion{K1: 0.1}, Point{X: 150, Y: 50}, Point{X: 160, Y: 50}},
+
+		// x = 1, y = 0: radial factor 1 - 0.2 + 0.05 + 0.01 = 0.86
+		{LensDistortion{K1: -0.2, K2: 0.05, K3: 0.01}, Point{X: 150, Y: 50}, Point{X: 136, Y: 50}},
+
+		// x = y = 1: r² = 2, radial factor 1.2,
+		// x' = 1.2 + 2·0.01 + 0.02·(2 + 2) = 1.3,
+		// y' = 1.2 + 0.01·(2 + 2) + 2·0.02 = 1.28
+		{LensDistortion{K1: 0.1, P1: 0.01, P2: 0.02}, Point{X: 150, Y: 150}, Point{X: 180, Y: 178}},
+	}
+	for _, tc := range tests {
+		if got := cam.Distort(tc.p, tc.ld); !got.Eq(tc.q, 1e-9) {
+			t.Fatalf("expected %+v to distort %v to %v but saw %v", tc.ld, tc.p, tc.q, got)
+		}
+		if got := cam.Undistort(tc.q, tc.ld); !got.Eq(tc.p, 1e-6) {
+			t.Fatalf("expected %+v to undistort %v to %v but saw %v", tc.ld, tc.q, tc.p, got)
+		}
+	}
+}
+
+// TestLensUndistort ensures that Undistort inverts Distort for typical
+// wide-angle lens parameters.
+func TestLensUndistort(t *testing.T) {
+	cam := CameraIntrinsics{FX: 520, FY: 515, CX: 322, CY: 238}
+	ld := LensDistortion{K1: -0.28, K2: 0.07, P1: 0.0012, P2: -0.0008, K3: 0.0}
+	rng := rand.New(rand.NewSource(42))
+	for i := 0; i < 200; i++ {
+		p := Point{X: rng.Float64() * 640, Y: rng.Float64() * 480}
+		if q := cam.Undistort(cam.Distort(p, ld), ld); !q.Eq(p, 1e-6) {
+			t.Fatalf("expected %v to round-trip but saw %v", p, q)
+		}
+	}
+}
+
+// TestNewLensMeshes ensures that lens-correction meshes place interior points
+// at the analytically computed locations and edge points on the image
+// boundary.
+func TestNewLensMeshes(t *testing.T) {
+	const nx, ny, wd, ht = 17, 13, 640, 480
+	cam := CameraIntrinsics{FX: 520, FY: 515, CX: 322, CY: 238}
+	ld := LensDistortion{K1: -0.2, K2: 0.05, P1: 0.001, P2: -0.001}
+	for _, distort := range []bool{false, true} {
+		src, dst, err := NewLensMeshes(cam, ld, nx, ny, wd, ht, distort)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reg := NewRegularMesh(nx, ny, wd, ht)
+		if d, _ := MaxDisplacement(dst, reg); d != 0.0 {
+			t.Fatalf("expected a regular destination mesh")
+		}
+		for r := 1; r < ny-1; r++ {
+			for c := 1; c < nx-1; c++ {
+				// When correcting distortion, each source point is
+				// the distorted destination point.  When simulating
+				// it, each destination point is the distorted
+				// source point.
+				want := cam.Distort(dst.Get(c, r), ld)
+				got := src.Get(c, r)
+				if distort {
+					want = dst.Get(c, r)
+					got = cam.Distort(got, ld)
+				}
+				if !got.Eq(want, 1e-6) {
+					t.Fatalf("distort=%v: expected %v at (%d, %d) but saw %v", distort, want, c, r, got)
+				}
+			}
+		}
+		if rep := src.Validate(wd, ht); !rep.OK() {
+			t.Fatalf("distort=%v: expected a valid source mesh but saw %+v", distort, rep)
+		}
+		src.Free()
+		dst.Free()
+		reg.Free()
+	}
+	if _, _, err := NewLensMeshes(cam, ld, 3, ny, wd, ht, false); err == nil {
+		t.Fatal("expected a too-small mesh to be rejected")
+	}
+}
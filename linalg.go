@@ -0,0 +1,155 @@
+// This file provides the small amount of dense linear algebra needed by the
+// rest of the package.
+
+package xmorph
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// solveLinear solves the square linear system a·x = b using Gaussian
+// elimination with partial pivoting.  Neither a nor b is modified.  It returns
+// an error if the system is singular.
+func solveLinear(a [][]float64, b []float64) ([]float64, error) {
+	// Form an augmented matrix.
+	n := len(a)
+	aug := make([][]float64, n)
+	for i := range aug {
+		aug[i] = make([]float64, n+1)
+		copy(aug[i], a[i])
+		aug[i][n] = b[i]
+	}
+
+	// Reduce the matrix to upper-triangular form.
+	for k := 0; k < n; k++ {
+		p := k
+		for i := k + 1; i < n; i++ {
+			if math.Abs(aug[i][k]) > math.Abs(aug[p][k]) {
+				p = i
+			}
+		}
+		if math.Abs(aug[p][k]) < 1e-12 {
+			return nil, fmt.Errorf("singular linear system")
+		}
+		aug[k], aug[p] = aug[p], aug[k]
+		for i := k + 1; i < n; i++ {
+			f := aug[i][k] / aug[k][k]
+			for j := k; j <= n; j++ {
+				aug[i][j] -= f * aug[k][j]
+			}
+		}
+	}
+
+	// Back-substitute to find x.
+	x := make([]float64, n)
+	for i := n - 1; i >= 0; i-- {
+		s := aug[i][n]
+		for j := i + 1; j < n; j++ {
+			s -= aug[i][j] * x[j]
+		}
+		x[i] = s / aug[i][i]
+	}
+	return x, nil
+}
+
+// leastSquares returns the x that minimizes |a·x - b|² for an m×n matrix a
+// with m ≥ n by solving the normal equations.
+func leastSquares(a [][]float64, b []float64) ([]float64, error) {
+	if len(a) == 0 {
+		return nil, fmt.Errorf("empty least-squares system")
+	}
+	n := len(a[0])
+	ata := make([][]float64, n)
+	atb := make([]float64, n)
+	for i := range ata {
+		ata[i] = make([]float64, n)
+	}
+	for r, row := range a {
+		for i := 0; i < n; i++ {
+			atb[i] += row[i] * b[r]
+			for j := 0; j < n; j++ {
+				ata[i][j] += row[i] * row[j]
+			}
+		}
+	}
+	return solveLinear(ata, atb)
+}
+
+// symmetricEigen returns the eigenvalues of a symmetric matrix in decreasing
+// order, along with the corresponding unit eigenvectors, using the cyclic
+// Jacobi method.  vecs[k] is the eigenvector for vals[k].  a is not
+// modified.
+func symmetricEigen(a [][]float64) (vals []float64, vecs [][]float64) {
+	// Copy a and initialize the eigenvector matrix to the identity.
+	n := len(a)
+	m := make([][]float64, n)
+	v := make([][]float64, n)
+	for i := range m {
+		m[i] = make([]float64, n)
+		copy(m[i], a[i])
+		v[i] = make([]float64, n)
+		v[i][i] = 1.0
+	}
+
+	// Repeatedly zero each off-diagonal element with a plane rotation.
+	for sweep := 0; sweep < 100; sweep++ {
+		off, diag := 0.0, 0.0
+		for i := 0; i < n; i++ {
+			diag += m[i][i] * m[i][i]
+			for j := i + 1; j < n; j++ {
+				off += m[i][j] * m[i][j]
+			}
+		}
+		if off <= 1e-30*diag || off == 0.0 {
+			break
+		}
+		for p := 0; p < n-1; p++ {
+			for q := p + 1; q < n; q++ {
+				if m[p][q] == 0.0 {
+					continue
+				}
+				theta := (m[q][q] - m[p][p]) / (2.0 * m[p][q])
+				t := 1.0 / (math.Abs(theta) + math.Sqrt(theta*theta+1.0))
+				if theta < 0.0 {
+					t = -t
+				}
+				c := 1.0 / math.Sqrt(t*t+1.0)
+				s := t * c
+				for k := 0; k < n; k++ {
+					mkp, mkq := m[k][p], m[k][q]
+					m[k][p] = c*mkp - s*mkq
+					m[k][q] = s*mkp + c*mkq
+				}
+				for k := 0; k < n; k++ {
+					mpk, mqk := m[p][k], m[q][k]
+					m[p][k] = c*mpk - s*mqk
+					m[q][k] = s*mpk + c*mqk
+				}
+				for k := 0; k < n; k++ {
+					vkp, vkq := v[k][p], v[k][q]
+					v[k][p] = c*vkp - s*vkq
+					v[k][q] = s*vkp + c*vkq
+				}
+			}
+		}
+	}
+
+	// Sort the eigenpairs by decreasing eigenvalue.
+	idx := make([]int, n)
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.Slice(idx, func(i, j int) bool { return m[idx[i]][idx[i]] > m[idx[j]][idx[j]] })
+	vals = make([]float64, n)
+	vecs = make([][]float64, n)
+	for k, i := range idx {
+		vals[k] = m[i][i]
+		vecs[k] = make([]float64, n)
+		for j := 0; j < n; j++ {
+			vecs[k][j] = v[j][i]
+		}
+	}
+	return vals, vecs
+}
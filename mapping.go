@@ -0,0 +1,181 @@
+// This file provides functions for mapping individual points through a mesh
+// warp.
+
+package xmorph
+
+import (
+	"fmt"
+	"image"
+	"math"
+)
+
+// A MeshMapping maps points through the warp that deforms a source mesh into
+// a destination mesh.  It follows libmorph's two-pass algorithm: a horizontal
+// pass that moves points along rows, followed by a vertical pass that moves
+// points along columns, with each pass interpolating between mesh points
+// using splines.
+type MeshMapping struct {
+	srcCols []*hermiteSpline // Column c of the source mesh: x_src = f(y_src)
+	midCols []*hermiteSpline // Column c of the intermediate mesh: x_dst = f(y_src)
+	midRows []*hermiteSpline // Row r of the intermediate mesh: y_src = f(x_dst)
+	dstRows []*hermiteSpline // Row r of the destination mesh: y_dst = f(x_dst)
+}
+
+// NewMeshMapping returns a MeshMapping from a source mesh to a destination
+// mesh.  It returns an error if the meshes are incompatible.
+func NewMeshMapping(src, dst *Mesh) (*MeshMapping, error) {
+	if src.NX != dst.NX || src.NY != dst.NY {
+		return nil, fmt.Errorf("incompatible meshes (%dx%d and %dx%d) passed to NewMeshMapping", src.NX, src.NY, dst.NX, dst.NY)
+	}
+	sp, dp := src.Points(), dst.Points()
+	ny, nx := len(sp), len(sp[0])
+
+	// The intermediate mesh takes its x coordinates from the destination
+	// mesh and its y coordinates from the source mesh.
+	mp := make([][]Point, ny)
+	for r := range mp {
+		mp[r] = make([]Point, nx)
+		for c := range mp[r] {
+			mp[r][c] = Point{X: dp[r][c].X, Y: sp[r][c].Y}
+		}
+	}
+
+	// Precompute all of the splines we'll need.
+	mm := &MeshMapping{
+		srcCols: make([]*hermiteSpline, nx),
+		midCols: make([]*hermiteSpline, nx),
+		midRows: make([]*hermiteSpline, ny),
+		dstRows: make([]*hermiteSpline, ny),
+	}
+	for c := 0; c < nx; c++ {
+		mm.srcCols[c] = columnSpline(sp, c)
+		mm.midCols[c] = columnSpline(mp, c)
+	}
+	for r := 0; r < ny; r++ {
+		mm.midRows[r] = rowSpline(mp, r)
+		mm.dstRows[r] = rowSpline(dp, r)
+	}
+	return mm, nil
+}
+
+// evalAll evaluates each of a list of splines at the same point.
+func evalAll(ss []*hermiteSpline, v float64) []float64 {
+	out := make([]float64, len(ss))
+	for i, s := range ss {
+		out[i] = s.eval(v)
+	}
+	return out
+}
+
+// Map maps a point in the source image to the corresponding point in the
+// destination image.
+func (mm *MeshMapping) Map(p Point) Point {
+	// Horizontal pass: move the point along its row.
+	a := evalAll(mm.srcCols, p.Y)
+	b := evalAll(mm.midCols, p.Y)
+	x := newHermiteSpline(a, b).eval(p.X)
+
+	// Vertical pass: move the point along its column.
+	c := evalAll(mm.midRows, x)
+	d := evalAll(mm.dstRows, x)
+	y := newHermiteSpline(c, d).eval(p.Y)
+	return Point{X: x, Y: y}
+}
+
+// InverseMap maps a point in the destination image to the point in the source
+// image from which it came.  Like libmorph's resampler, it numerically inverts
+// the forward splines used by each pass, so for functional meshes it exactly
+// undoes Map.
+func (mm *MeshMapping) InverseMap(p Point) Point {
+	// Undo the vertical pass.
+	c := evalAll(mm.midRows, p.X)
+	d := evalAll(mm.dstRows, p.X)
+	y := newHermiteSpline(c, d).invert(p.Y)
+
+	// Undo the horizontal pass.
+	a := evalAll(mm.srcCols, y)
+	b := evalAll(mm.midCols, y)
+	x := newHermiteSpline(a, b).invert(p.X)
+	return Point{X: x, Y: y}
+}
+
+// MapPoints applies Map to each of a slice of points.
+func (mm *MeshMapping) MapPoints(pts []Point) []Point {
+	out := make([]Point, len(pts))
+	for i, p := range pts {
+		out[i] = mm.Map(p)
+	}
+	return out
+}
+
+// InverseMapPoints applies InverseMap to each of a slice of points.
+func (mm *MeshMapping) InverseMapPoints(pts []Point) []Point {
+	out := make([]Point, len(pts))
+	for i, p := range pts {
+		out[i] = mm.InverseMap(p)
+	}
+	return out
+}
+
+// mapRect returns the bounding box of the image of a rectangle's boundary,
+// sampled at every pixel, under a point mapping.
+func mapRect(r image.Rectangle, f func(Point) Point) image.Rectangle {
+	if r.Empty() {
+		return image.Rectangle{}
+	}
+	ul := Point{X: math.Inf(1), Y: math.Inf(1)}
+	lr := Point{X: math.Inf(-1), Y: math.Inf(-1)}
+	add := func(x, y int) {
+		q := f(Point{X: float64(x), Y: float64(y)})
+		ul.X = math.Min(ul.X, q.X)
+		ul.Y = math.Min(ul.Y, q.Y)
+		lr.X = math.Max(lr.X, q.X)
+		lr.Y = math.Max(lr.Y, q.Y)
+	}
+	for x := r.Min.X; x <= r.Max.X; x++ {
+		add(x, r.Min.Y)
+		add(x, r.Max.Y)
+	}
+	for y := r.Min.Y; y <= r.Max.Y; y++ {
+		add(r.Min.X, y)
+		add(r.Max.X, y)
+	}
+	return image.Rect(
+		int(math.Floor(ul.X)), int(math.Floor(ul.Y)),
+		int(math.Ceil(lr.X)), int(math.Ceil(lr.Y)))
+}
+
+// MapRect returns the smallest rectangle that encloses the image of a
+// rectangle (e.g., a bounding box) under Map.
+func (mm *MeshMapping) MapRect(r image.Rectangle) image.Rectangle {
+	return mapRect(r, mm.Map)
+}
+
+// InverseMapRect returns the smallest rectangle that encloses the image of a
+// rectangle under InverseMap.
+func (mm *MeshMapping) InverseMapRect(r image.Rectangle) image.Rectangle {
+	return mapRect(r, mm.InverseMap)
+}
+
+// MapPoint reports where a point in an image lands after the image is warped
+// from a source mesh to a destination mesh (i.e., Warp with t = 1.0).  It
+// panics if the meshes are incompatible.  Use NewMeshMapping when mapping
+// many points through the same pair of meshes.
+func MapPoint(src, dst *Mesh, p Point) Point {
+	mm, err := NewMeshMapping(src, dst)
+	if err != nil {
+		panic(err)
+	}
+	return mm.Map(p)
+}
+
+// InverseMapPoint reports which point in an image lands at a given point
+// after the image is warped from a source mesh to a destination mesh.  It
+// panics if the meshes are incompatible.
+func InverseMapPoint(src, dst *Mesh, p Point) Point {
+	mm, err := NewMeshMapping(src, dst)
+	if err != nil {
+		panic(err)
+	}
+	return mm.InverseMap(p)
+}
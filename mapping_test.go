@@ -0,0 +1,95 @@
+// The functions defined in this file ensure the xmorph package's
+// point-mapping operations work as expected.
+
+package xmorph
+
+import (
+	"image"
+	"math/rand"
+	"testing"
+)
+
+// TestMapPointIdentity ensures that mapping through identical meshes leaves
+// points unchanged.
+func TestMapPointIdentity(t *testing.T) {
+	m := NewRegularMesh(6, 5, 200, 150)
+	defer m.Free()
+	rng := rand.New(rand.NewSource(36))
+	for i := 0; i < 100; i++ {
+		p := Point{X: rng.Float64() * 199, Y: rng.Float64() * 149}
+		if q := MapPoint(m, m, p); !q.Eq(p, 1e-9) {
+			t.Fatalf("expected %v to map to itself but saw %v", p, q)
+		}
+		if q := InverseMapPoint(m, m, p); !q.Eq(p, 1e-9) {
+			t.Fatalf("expected %v to inverse-map to itself but saw %v", p, q)
+		}
+	}
+}
+
+// TestMapPointVertices ensures that source mesh points map exactly to the
+// corresponding destination mesh points and back.
+func TestMapPointVertices(t *testing.T) {
+	const nx, ny, wd, ht = 7, 6, 241, 201
+	rng := rand.New(rand.NewSource(37))
+	src := NewRegularMesh(nx, ny, wd, ht)
+	defer src.Free()
+	dst := jaggedMesh(rng, nx, ny, wd, ht, 0.3)
+	defer dst.Free()
+	mm, err := NewMeshMapping(src, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for r := 0; r < ny; r++ {
+		for c := 0; c < nx; c++ {
+			p, q := src.Get(c, r), dst.Get(c, r)
+			if mp := mm.Map(p); !mp.Eq(q, 1e-6) {
+				t.Fatalf("expected %v to map to %v but saw %v", p, q, mp)
+			}
+			if ip := mm.InverseMap(q); !ip.Eq(p, 1e-6) {
+				t.Fatalf("expected %v to inverse-map to %v but saw %v", q, p, ip)
+			}
+		}
+	}
+
+	// Ensure that the inverse undoes the forward mapping
+	// everywhere.
+	pts := make([]Point, 200)
+	for i := range pts {
+		pts[i] = Point{X: rng.Float64() * (wd - 1), Y: rng.Float64() * (ht - 1)}
+	}
+	back := mm.InverseMapPoints(mm.MapPoints(pts))
+	for i, p := range pts {
+		if !back[i].Eq(p, 1e-6) {
+			t.Fatalf("expected %v to round-trip but saw %v", p, back[i])
+		}
+	}
+}
+
+// TestMapRect ensures that rectangles map to the bounding boxes of their
+// images.
+func TestMapRect(t *testing.T) {
+	const nx, ny, wd, ht = 5, 5, 101, 101
+	src := NewRegularMesh(nx, ny, wd, ht)
+	defer src.Free()
+	dst := src.Copy()
+	defer dst.Free()
+	dst.Set(2, 2, Point{X: 60, Y: 55})
+	mm, err := NewMeshMapping(src, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := image.Rect(45, 45, 55, 55)
+	mr := mm.MapRect(r)
+	if !image.Pt(60, 55).In(mr) {
+		t.Fatalf("expected %v to contain (60, 55)", mr)
+	}
+	if mr.Dx() < 5 || mr.Dy() < 5 {
+		t.Fatalf("mapped rectangle %v is implausibly small", mr)
+	}
+	if ir := mm.InverseMapRect(mr); !r.In(ir.Inset(-1)) {
+		t.Fatalf("expected %v to enclose %v", ir, r)
+	}
+	if _, err = NewMeshMapping(src, NewRegularMesh(4, 4, wd, ht)); err == nil {
+		t.Fatal("expected incompatible meshes to be rejected")
+	}
+}
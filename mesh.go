@@ -10,20 +10,24 @@ package xmorph
 */
 import "C"
 import (
-	"bufio"
 	"fmt"
 	"image"
 	"io"
 	"math"
+	"strconv"
 	"strings"
 	"unsafe"
 )
 
 // A Mesh represents a 2-D mesh.
 type Mesh struct {
-	NX   int      // Number of mesh points in the x direction
-	NY   int      // Number of mesh points in the y direction
-	mesh *C.MeshT // Underlying mesh representation
+	NX    int           // Number of mesh points in the x direction
+	NY    int           // Number of mesh points in the y direction
+	mesh  *C.MeshT      // Underlying mesh representation
+	hist  *meshHistory  // Edit history (nil if disabled)
+	index *meshIndex    // Spatial index for picking (nil if not yet built)
+	sym   *meshSymmetry // Line of symmetry for editing (nil if none)
+	depth int           // Nesting depth of the current transaction
 }
 
 // NewEmptyMesh creates a new, empty mesh of a given number of vertices.
@@ -39,6 +43,10 @@ func NewEmptyMesh(nx, ny int) *Mesh {
 func (m *Mesh) Free() {
 	C.meshUnref(m.mesh)
 	m.mesh = nil
+	m.hist = nil
+	m.index = nil
+	m.sym = nil
+	m.depth = 0
 }
 
 // MeshFromPoints creates a new mesh from a 2-D slice of xmorph.Points.
@@ -74,70 +82,168 @@ func MeshFromPoints(sl [][]Point) *Mesh {
 }
 
 // ReadMesh reads a morph/xmorph/gtkmorph mesh file and returns a Mesh object.
+// The current (M2) format and the legacy M1 and headerless formats are
+// detected automatically.  Blank lines, comment lines (beginning with "#"),
+// and CRLF line endings are tolerated.  Errors that arise from malformed input
+// are of type *MeshParseError.
 func ReadMesh(r io.Reader) (*Mesh, error) {
-	// An empty error from a scan implies EOF.  We want to report
-	// it as such.
-	scanner := bufio.NewScanner(r)
-	getErr := func() error {
-		err := scanner.Err()
-		if err == nil {
-			return io.EOF
+	return ReadMeshOptions(r, MeshReadOptions{})
+}
+
+// ReadMeshOptions is like ReadMesh but accepts options that control parsing.
+func ReadMeshOptions(r io.Reader, opts MeshReadOptions) (*Mesh, error) {
+	m, _, err := ReadMeshFormat(r, opts)
+	return m, err
+}
+
+// ReadMeshFormat is like ReadMeshOptions but additionally reports the format
+// of the mesh file that was read.
+func ReadMeshFormat(r io.Reader, opts MeshReadOptions) (*Mesh, MeshFormat, error) {
+	// Parse the file header, if any.
+	lr := newMeshLineReader(r)
+	toks, err := lr.next()
+	if err != nil {
+		return nil, AutoMeshFormat, lr.readError("mesh header", err, true)
+	}
+	format := MeshFormatHeaderless
+	if len(toks) == 1 {
+		switch toks[0].text {
+		case "M2":
+			format = MeshFormatM2
+		case "M1":
+			format = MeshFormatM1
+		default:
+			return nil, AutoMeshFormat, lr.lineError("mesh header", toks, fmt.Errorf("should be \"M2\", \"M1\", or the mesh dimensions"))
 		}
-		return err
 	}
-
-	// Parse the file header.
-	if !scanner.Scan() {
-		return nil, fmt.Errorf("failed to read the mesh header (%w)", getErr())
+	if opts.Format != AutoMeshFormat && opts.Format != format {
+		return nil, AutoMeshFormat, lr.lineError("mesh header", toks, fmt.Errorf("expected the %s format but found the %s format", opts.Format, format))
 	}
-	if scanner.Text() != "M2" {
-		return nil, fmt.Errorf("invalid mesh header (should be \"M2\")")
+	m, err := readMeshBody(lr, toks, format, opts.Strict)
+	if err != nil {
+		return nil, AutoMeshFormat, err
 	}
+	return m, format, nil
+}
 
+// readMeshBody reads the mesh dimensions and points from a mesh file whose
+// header, if any, has already been consumed.  For headerless files, the
+// already-read dimension tokens must be provided.
+func readMeshBody(lr *meshLineReader, toks []meshToken, format MeshFormat, strict bool) (*Mesh, error) {
 	// Read the mesh dimensions.
-	if !scanner.Scan() {
-		return nil, fmt.Errorf("failed to read the mesh dimensions (%w)", getErr())
+	var err error
+	if format != MeshFormatHeaderless {
+		toks, err = lr.next()
+		if err != nil {
+			return nil, lr.readError("mesh dimensions", err, false)
+		}
 	}
-	var nx, ny int
-	ln := scanner.Text()
-	ntoks, err := fmt.Sscan(ln, &nx, &ny)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse %q as mesh dimensions (%w)", ln, err)
+	if len(toks) < 2 || (strict && len(toks) > 2) {
+		return nil, lr.lineError("mesh dimensions", toks, fmt.Errorf("expected 2 values but saw %d", len(toks)))
 	}
-	if ntoks != 2 {
-		return nil, fmt.Errorf("failed to parse %q as mesh dimensions", ln)
+	var dims [2]int
+	for i, f := range []string{"mesh width", "mesh height"} {
+		dims[i], err = strconv.Atoi(toks[i].text)
+		if err != nil {
+			return nil, lr.tokenError(f, toks[i], err)
+		}
 	}
+	nx, ny := dims[0], dims[1]
 	if nx < 4 || ny < 4 {
-		return nil, fmt.Errorf("mesh must be at least 4x4 (read %dx%d)", nx, ny)
+		return nil, lr.lineError("mesh dimensions", toks, fmt.Errorf("mesh must be at least 4x4 (read %dx%d)", nx, ny))
 	}
 
 	// Parse each of the remaining lines into mesh coordinates and a label.
-	sl := make([][]Point, ny)
-	for j := range sl {
-		sl[j] = make([]Point, nx)
-		for i := range sl[j] {
-			if !scanner.Scan() {
-				return nil, fmt.Errorf("failed to read %d mesh coordinates (%w)", nx*ny, getErr())
-			}
-			ln = scanner.Text()
-			var x, y int
-			var label int
-			ntoks, err = fmt.Sscan(ln, &x, &y, &label)
+	// Rows are allocated as they are read so that a bogus mesh size cannot
+	// exhaust memory.
+	var sl [][]Point
+	var labels []int
+	for j := 0; j < ny; j++ {
+		row := make([]Point, 0, 16)
+		for i := 0; i < nx; i++ {
+			toks, err = lr.next()
 			if err != nil {
-				return nil, fmt.Errorf("failed to parse %q as {x, y, label} (%w)", ln, err)
-			}
-			if ntoks != 3 {
-				return nil, fmt.Errorf("failed to parse %q as {x, y, label}", ln)
+				return nil, lr.readError(fmt.Sprintf("mesh coordinates for point (%d, %d) of %dx%d", i, j, nx, ny), err, false)
 			}
-			sl[j][i] = Point{
-				X: float64(x) / 10.0,
-				Y: float64(y) / 10.0,
+			pt, label, err := parseMeshPoint(lr, toks, format, strict)
+			if err != nil {
+				return nil, err
 			}
+			row = append(row, pt)
+			labels = append(labels, label)
+		}
+		sl = append(sl, row)
+	}
+
+	// In strict mode, ensure that anything following the mesh data begins
+	// a tagged section.
+	if strict {
+		toks, err = lr.next()
+		switch {
+		case err == io.EOF:
+		case err != nil:
+			return nil, lr.readError("trailing data", err, true)
+		case !strings.HasPrefix(toks[0].text, "<"):
+			return nil, lr.lineError("trailing data", toks, fmt.Errorf("expected end of file or a tagged section"))
 		}
 	}
 
 	// Create and return a Mesh object.
-	return MeshFromPoints(sl), nil
+	m := MeshFromPoints(sl)
+	for i, label := range labels {
+		m.SetLabel(i%nx, i/nx, label)
+	}
+	return m, nil
+}
+
+// parseMeshPoint parses a tokenized line of a mesh file into a Point and a
+// label.
+func parseMeshPoint(lr *meshLineReader, toks []meshToken, format MeshFormat, strict bool) (Point, int, error) {
+	// Ensure we have the right number of tokens.  Only the M2 format
+	// includes labels.
+	field, ntoks := "{x, y, label}", 3
+	if format != MeshFormatM2 {
+		field, ntoks = "{x, y}", 2
+	}
+	if len(toks) < 2 || (strict && len(toks) != ntoks) {
+		return Point{}, 0, lr.lineError(field, toks, fmt.Errorf("expected %d values but saw %d", ntoks, len(toks)))
+	}
+
+	// Parse the coordinates.
+	var xy [2]float64
+	for i, f := range []string{"x coordinate", "y coordinate"} {
+		var err error
+		if strict {
+			var v int
+			v, err = strconv.Atoi(toks[i].text)
+			xy[i] = float64(v)
+		} else {
+			xy[i], err = strconv.ParseFloat(toks[i].text, 64)
+		}
+		if err == nil && (math.IsNaN(xy[i]) || math.IsInf(xy[i], 0)) {
+			err = fmt.Errorf("coordinates must be finite")
+		}
+		if err != nil {
+			return Point{}, 0, lr.tokenError(f, toks[i], err)
+		}
+	}
+
+	// Parse the label, if present.
+	label := 0
+	if format == MeshFormatM2 && len(toks) >= 3 {
+		var err error
+		label, err = strconv.Atoi(toks[2].text)
+		if err != nil {
+			return Point{}, 0, lr.tokenError("label", toks[2], err)
+		}
+	}
+
+	// M2 coordinates are stored in tenths of a pixel.
+	if format == MeshFormatM2 {
+		xy[0] /= 10.0
+		xy[1] /= 10.0
+	}
+	return Point{X: xy[0], Y: xy[1]}, label, nil
 }
 
 // MeshFromImagePoints creates a new mesh from a 2-D slice of image.Points.
@@ -256,18 +362,44 @@ func (m *Mesh) meshRanges() (Point, Point) {
 
 // Write outputs a mesh that's compatible with morph, xmorph, and gtkmorph.
 func (m *Mesh) Write(w io.Writer) error {
-	// Write the two header lines.
+	return m.WriteFormat(w, MeshFormatM2)
+}
+
+// WriteFormat outputs a mesh in a given format.  The legacy MeshFormatM1 and
+// MeshFormatHeaderless formats are intended for old tooling; they round
+// coordinates to whole pixels and discard labels and subimage information.
+func (m *Mesh) WriteFormat(w io.Writer, f MeshFormat) error {
+	// Write the header lines.
 	var err error
-	if _, err = fmt.Fprintln(w, "M2"); err != nil {
-		return err
+	switch f {
+	case MeshFormatM2, MeshFormatM1:
+		if _, err = fmt.Fprintln(w, f); err != nil {
+			return err
+		}
+	case MeshFormatHeaderless:
+	default:
+		return fmt.Errorf("cannot write a mesh in the %s format", f)
 	}
 	nx, ny := int(m.mesh.nx), int(m.mesh.ny)
 	if _, err = fmt.Fprintln(w, nx, ny); err != nil {
 		return err
 	}
 
-	// Write all of the data.
+	// Legacy formats contain only whole-pixel coordinates.
 	np := nx * ny
+	if f != MeshFormatM2 {
+		for _, row := range m.Points() {
+			for _, pt := range row {
+				_, err = fmt.Fprintf(w, "%.0f %.0f\n", math.Round(pt.X), math.Round(pt.Y))
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	// Write all of the data.
 	xp := (*[1 << 30]C.double)(unsafe.Pointer(m.mesh.x))[:np:np]
 	yp := (*[1 << 30]C.double)(unsafe.Pointer(m.mesh.y))[:np:np]
 	lp := (*[1 << 30]C.int)(unsafe.Pointer(m.mesh.label))[:np:np]
@@ -358,31 +490,84 @@ func (m *Mesh) GetImagePoint(x, y int) image.Point {
 	}
 }
 
-// Set assigns the xmorph.Point at (x, y).
-func (m *Mesh) Set(x, y int, pt Point) {
+// setPoint assigns the xmorph.Point at (x, y) without recording the change
+// in the mesh's edit history.
+func (m *Mesh) setPoint(x, y int, pt Point) {
 	m.checkMeshCoord(x, y)
 	cx, cy := C.int(x), C.int(y)
 	C.meshSetNoundo(m.mesh, cx, cy, C.double(pt.X), C.double(pt.Y))
+	m.index = nil
+}
+
+// setRecorded assigns the xmorph.Point at (x, y), recording the change in the
+// mesh's edit history but ignoring symmetry.
+func (m *Mesh) setRecorded(x, y int, pt Point) {
+	if m.hist != nil {
+		m.recordPoint(x, y, pt)
+	}
+	m.setPoint(x, y, pt)
+}
+
+// Set assigns the xmorph.Point at (x, y).  In symmetric-editing mode (see
+// EnableSymmetry), Set also assigns the point's mirrored partner.
+func (m *Mesh) Set(x, y int, pt Point) {
+	if m.sym != nil {
+		m.setSymmetric(x, y, pt)
+		return
+	}
+	m.setRecorded(x, y, pt)
 }
 
 // SetImagePoint assigns the image.Point at (x, y).
 func (m *Mesh) SetImagePoint(x, y int, pt image.Point) {
+	m.Set(x, y, Point{X: float64(pt.X), Y: float64(pt.Y)})
+}
+
+// GetLabel returns the label associated with the mesh point at (x, y).
+// libmorph uses labels to tag mesh points, for example to mark them as fixed.
+func (m *Mesh) GetLabel(x, y int) int {
 	m.checkMeshCoord(x, y)
-	cx, cy := C.int(x), C.int(y)
-	C.meshSetNoundo(m.mesh, cx, cy, C.double(pt.X), C.double(pt.Y))
+	np := int(m.mesh.nx * m.mesh.ny)
+	lp := (*[1 << 30]C.int)(unsafe.Pointer(m.mesh.label))[:np:np]
+	return int(lp[y*int(m.mesh.nx)+x])
+}
+
+// setLabel assigns the label associated with the mesh point at (x, y)
+// without recording the change in the mesh's edit history.
+func (m *Mesh) setLabel(x, y, label int) {
+	np := int(m.mesh.nx * m.mesh.ny)
+	lp := (*[1 << 30]C.int)(unsafe.Pointer(m.mesh.label))[:np:np]
+	lp[y*int(m.mesh.nx)+x] = C.int(label)
+}
+
+// SetLabel assigns the label associated with the mesh point at (x, y).
+func (m *Mesh) SetLabel(x, y, label int) {
+	m.checkMeshCoord(x, y)
+	if m.hist != nil && m.GetLabel(x, y) != label {
+		m.recordLabel(x, y, label)
+	}
+	m.setLabel(x, y, label)
 }
 
 // Functionalize fixes problems with the mesh, making it both functional and
 // bounded.  It takes as input the width and height of the image to which the
 // mesh corresponds and returns the number of changes made.
 func (m *Mesh) Functionalize(w, h int) int {
+	before := m.snapshot()
 	nc := C.meshFunctionalize(m.mesh, C.int(w), C.int(h))
+	if nc > 0 {
+		m.index = nil
+		m.recordState(before)
+	}
 	return int(nc)
 }
 
 // Scale scales mesh coordinates to fit a given image width and height.
 func (m *Mesh) Scale(w, h int) {
+	before := m.snapshot()
 	C.meshScale(m.mesh, C.int(w), C.int(h))
+	m.index = nil
+	m.recordState(before)
 }
 
 // A Direction can be either horizontal or vertical.
@@ -395,7 +580,8 @@ const (
 )
 
 // AddLine adds a row or column to the mesh, fraction f of the way
-// from index i to index i + 1.
+// from index i to index i + 1.  It returns an error if the mesh is in
+// symmetric-editing mode.
 func (m *Mesh) AddLine(i int, f float64, d Direction) error {
 	// Sanity-check our arguments so libmorph doesn't write its own error
 	// message to stderr.
@@ -414,18 +600,25 @@ func (m *Mesh) AddLine(i int, f float64, d Direction) error {
 	if f < 0.0 || f > 1.0 {
 		return fmt.Errorf("line-adding fraction must lie in [0.0, 1.0]")
 	}
+	if m.sym != nil {
+		return fmt.Errorf("cannot add a line to a mesh in symmetric-editing mode")
+	}
 
 	// Add the line.
+	before := m.snapshot()
 	r := C.meshLineAdd(m.mesh, C.int(i), C.double(f), C.int(d))
 	if r != 0 {
 		return fmt.Errorf("AddLine failed to add a line (id = %d)", r)
 	}
 	m.NX = int(m.mesh.nx)
 	m.NY = int(m.mesh.ny)
+	m.index = nil
+	m.recordState(before)
 	return nil
 }
 
-// DeleteLine deletes a row or column from the mesh.
+// DeleteLine deletes a row or column from the mesh.  It returns an error if
+// the mesh is in symmetric-editing mode.
 func (m *Mesh) DeleteLine(i int, d Direction) error {
 	// Sanity-check our arguments so libmorph doesn't write its own error
 	// message to stderr.
@@ -442,13 +635,20 @@ func (m *Mesh) DeleteLine(i int, d Direction) error {
 		return fmt.Errorf("unexpected direction %d", d)
 	}
 
+	if m.sym != nil {
+		return fmt.Errorf("cannot delete a line from a mesh in symmetric-editing mode")
+	}
+
 	// Delete the line.
+	before := m.snapshot()
 	r := C.meshLineDelete(m.mesh, C.int(i), C.int(d))
 	if r != 0 {
-		return fmt.Errorf("AddLine failed to add a line (id = %d)", r)
+		return fmt.Errorf("DeleteLine failed to delete a line (id = %d)", r)
 	}
 	m.NX = int(m.mesh.nx)
 	m.NY = int(m.mesh.ny)
+	m.index = nil
+	m.recordState(before)
 	return nil
 }
 
@@ -0,0 +1,48 @@
+//go:build go1.18
+// +build go1.18
+
+// The functions defined in this file fuzz the xmorph package's mesh parser.
+
+package xmorph
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// FuzzReadMesh ensures that ReadMesh never panics, that all of its errors are
+// *MeshParseErrors, and that every mesh it accepts survives a round trip
+// through Write.
+func FuzzReadMesh(f *testing.F) {
+	f.Add(smallMeshStr)
+	f.Add(strings.ReplaceAll(smallMeshStr, "\n", "\r\n"))
+	f.Add("M2\n4 4\n# comment\n\n")
+	f.Add("M2\n1000000000 4\n")
+	f.Fuzz(func(t *testing.T, s string) {
+		for _, strict := range []bool{false, true} {
+			m, err := ReadMeshOptions(strings.NewReader(s), MeshReadOptions{Strict: strict})
+			if err != nil {
+				var pe *MeshParseError
+				if !errors.As(err, &pe) {
+					t.Fatalf("expected a *MeshParseError but saw %T (%v)", err, err)
+				}
+				continue
+			}
+			var buf bytes.Buffer
+			if err = m.Write(&buf); err != nil {
+				t.Fatal(err)
+			}
+			m2, err := ReadMesh(&buf)
+			if err != nil {
+				t.Fatalf("failed to reread a written mesh (%v)", err)
+			}
+			if m2.NX != m.NX || m2.NY != m.NY {
+				t.Fatalf("mesh changed size from %dx%d to %dx%d", m.NX, m.NY, m2.NX, m2.NY)
+			}
+			m.Free()
+			m2.Free()
+		}
+	})
+}
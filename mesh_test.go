@@ -5,7 +5,10 @@ package xmorph
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
 	"image"
+	"io"
 	"math"
 	"math/rand"
 	"strings"
@@ -407,6 +410,207 @@ feature 2
 	}
 }
 
+// smallMeshStr is a minimal 4x4 mesh file.
+const smallMeshStr = `M2
+4 4
+0 0 0
+100 0 0
+200 0 0
+300 0 0
+0 100 0
+100 100 0
+200 100 0
+300 100 0
+0 200 0
+100 200 0
+200 200 0
+300 200 0
+0 300 0
+100 300 0
+200 300 0
+300 300 0
+`
+
+// TestReadMeshTolerant ensures that ReadMesh tolerates blank lines, comments,
+// CRLF line endings, and extra whitespace.
+func TestReadMeshTolerant(t *testing.T) {
+	lines := strings.Split(smallMeshStr, "\n")
+	var sb strings.Builder
+	sb.WriteString("# A comment before the header\r\n")
+	for i, ln := range lines {
+		sb.WriteString("  " + strings.ReplaceAll(ln, " ", " \t ") + " \r\n")
+		if i%3 == 0 {
+			sb.WriteString("\r\n   # An interspersed comment\r\n\r\n")
+		}
+	}
+	for _, strict := range []bool{false, true} {
+		m, err := ReadMeshOptions(strings.NewReader(sb.String()), MeshReadOptions{Strict: strict})
+		if err != nil {
+			t.Fatal(err)
+		}
+		validateMeshDimens(t, m, 4, 4)
+		for r := 0; r < 4; r++ {
+			for c := 0; c < 4; c++ {
+				exp := Point{X: float64(c * 10), Y: float64(r * 10)}
+				if pt := m.Get(c, r); pt != exp {
+					t.Fatalf("expected (%d, %d) = %v but observed %v", c, r, exp, pt)
+				}
+			}
+		}
+		m.Free()
+	}
+}
+
+// TestReadMeshErrors ensures that ReadMesh reports the line and column of
+// malformed input.
+func TestReadMeshErrors(t *testing.T) {
+	tests := []struct {
+		in     string // Replacement for the text in smallMeshStr
+		out    string
+		strict bool
+		line   int
+		column int
+		field  string
+	}{
+		{"M2\n", "M3\n", false, 1, 0, "mesh header"},
+		{"4 4\n", "4 x\n", false, 2, 3, "mesh height"},
+		{"4 4\n", "3 4\n", false, 2, 0, "mesh dimensions"},
+		{"4 4\n", "4 4 4\n", true, 2, 0, "mesh dimensions"},
+		{"200 100 0\n", "200 1O0 0\n", false, 9, 5, "y coordinate"},
+		{"200 100 0\n", "200 100 zero\n", false, 9, 9, "label"},
+		{"200 100 0\n", "200 NaN 0\n", false, 9, 5, "y coordinate"},
+		{"200 100 0\n", "200.5 100 0\n", true, 9, 1, "x coordinate"},
+		{"200 100 0\n", "200 100 0 7\n", true, 9, 0, "{x, y, label}"},
+		{"200 100 0\n", "200 100\n", true, 9, 0, "{x, y, label}"},
+		{"300 300 0\n", "300 300 0\ngarbage\n", true, 19, 0, "trailing data"},
+	}
+	for _, tst := range tests {
+		str := strings.Replace(smallMeshStr, tst.in, tst.out, 1)
+		_, err := ReadMeshOptions(strings.NewReader(str), MeshReadOptions{Strict: tst.strict})
+		if err == nil {
+			t.Fatalf("expected an error when replacing %q with %q", tst.in, tst.out)
+		}
+		var pe *MeshParseError
+		if !errors.As(err, &pe) {
+			t.Fatalf("expected a *MeshParseError but saw %T (%v)", err, err)
+		}
+		if pe.Line != tst.line || pe.Column != tst.column || pe.Field != tst.field {
+			t.Fatalf("expected an error at line %d, column %d, field %q but saw %v",
+				tst.line, tst.column, tst.field, err)
+		}
+
+		// Ensure that lenient mode accepts what strict mode rejects.
+		if tst.strict {
+			_, err = ReadMesh(strings.NewReader(str))
+			if err != nil {
+				t.Fatalf("non-strict parsing unexpectedly failed (%v)", err)
+			}
+		}
+	}
+
+	// Ensure that truncation is reported as an unexpected EOF.
+	_, err := ReadMesh(strings.NewReader(smallMeshStr[:strings.Index(smallMeshStr, "0 200 0")]))
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("expected io.ErrUnexpectedEOF but saw %v", err)
+	}
+	_, err = ReadMesh(strings.NewReader(""))
+	if !errors.Is(err, io.EOF) {
+		t.Fatalf("expected io.EOF but saw %v", err)
+	}
+}
+
+// TestReadMeshHugeDimensions ensures that a mesh file that claims to be
+// enormous but is truncated fails cleanly.
+func TestReadMeshHugeDimensions(t *testing.T) {
+	_, err := ReadMesh(strings.NewReader("M2\n1000000000 1000000000\n0 0 0\n"))
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("expected io.ErrUnexpectedEOF but saw %v", err)
+	}
+}
+
+// TestReadMeshLabels ensures that ReadMesh preserves point labels.
+func TestReadMeshLabels(t *testing.T) {
+	str := strings.Replace(smallMeshStr, "200 100 0\n", "200 100 3\n", 1)
+	m, err := ReadMesh(strings.NewReader(str))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Free()
+	for r := 0; r < 4; r++ {
+		for c := 0; c < 4; c++ {
+			exp := 0
+			if c == 2 && r == 1 {
+				exp = 3
+			}
+			if l := m.GetLabel(c, r); l != exp {
+				t.Fatalf("expected (%d, %d) to have label %d but saw %d", c, r, exp, l)
+			}
+		}
+	}
+}
+
+// TestReadMeshLegacy ensures that ReadMeshFormat recognizes legacy mesh
+// formats.
+func TestReadMeshLegacy(t *testing.T) {
+	// Convert smallMeshStr to whole-pixel "x y" lines.
+	var body strings.Builder
+	body.WriteString("4 4\n")
+	for r := 0; r < 4; r++ {
+		for c := 0; c < 4; c++ {
+			fmt.Fprintf(&body, "%d %d\n", c*10, r*10)
+		}
+	}
+	tests := []struct {
+		str    string
+		format MeshFormat
+	}{
+		{smallMeshStr, MeshFormatM2},
+		{"M1\n" + body.String(), MeshFormatM1},
+		{body.String(), MeshFormatHeaderless},
+	}
+	for _, tst := range tests {
+		m, f, err := ReadMeshFormat(strings.NewReader(tst.str), MeshReadOptions{Strict: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f != tst.format {
+			t.Fatalf("expected format %s but saw %s", tst.format, f)
+		}
+		for r := 0; r < 4; r++ {
+			for c := 0; c < 4; c++ {
+				exp := Point{X: float64(c * 10), Y: float64(r * 10)}
+				if pt := m.Get(c, r); pt != exp {
+					t.Fatalf("expected (%d, %d) = %v but observed %v", c, r, exp, pt)
+				}
+			}
+		}
+
+		// Ensure that writing the mesh in the same format reproduces
+		// the mesh data.
+		var buf bytes.Buffer
+		if err = m.WriteFormat(&buf, f); err != nil {
+			t.Fatal(err)
+		}
+		out := buf.String()
+		if f == MeshFormatM2 {
+			out = out[:strings.Index(out, "<SIS>")]
+		}
+		if out != tst.str {
+			t.Fatalf("expected %q but wrote %q", tst.str, out)
+		}
+		m.Free()
+
+		// Ensure that requesting a different format fails.
+		opts := MeshReadOptions{Format: MeshFormatM2}
+		if f == MeshFormatM2 {
+			opts.Format = MeshFormatM1
+		}
+		if _, err = ReadMeshOptions(strings.NewReader(tst.str), opts); err == nil {
+			t.Fatalf("expected reading %s as %s to fail", f, opts.Format)
+		}
+	}
+}
+
 // TestMeshGetSet ensures we can get and set mesh points.
 func TestMeshGetSet(t *testing.T) {
 	// Set mesh points to arbitrary values.  We do so in column-major order
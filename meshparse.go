@@ -0,0 +1,189 @@
+// This file provides support code for parsing mesh files.
+
+package xmorph
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// A MeshParseError reports the location and nature of a failure to parse a
+// mesh file.
+type MeshParseError struct {
+	Line   int    // 1-based line number at which the error occurred
+	Column int    // 1-based column of the offending token (0 = entire line)
+	Field  string // Name of the item being parsed (e.g., "mesh header" or "x coordinate")
+	Text   string // Text of the offending token or line
+	Err    error  // Underlying error, if any
+}
+
+// Error returns a MeshParseError as a string.
+func (e *MeshParseError) Error() string {
+	pos := fmt.Sprintf("line %d", e.Line)
+	if e.Column > 0 {
+		pos += fmt.Sprintf(", column %d", e.Column)
+	}
+	var msg string
+	if e.Text == "" {
+		msg = fmt.Sprintf("%s: failed to read the %s", pos, e.Field)
+	} else {
+		msg = fmt.Sprintf("%s: failed to parse %q as the %s", pos, e.Text, e.Field)
+	}
+	if e.Err != nil {
+		msg += fmt.Sprintf(" (%v)", e.Err)
+	}
+	return msg
+}
+
+// Unwrap returns a MeshParseError's underlying error.
+func (e *MeshParseError) Unwrap() error {
+	return e.Err
+}
+
+// A MeshFormat identifies one of the mesh file layouts used by various
+// versions of morph, xmorph, and gtkmorph.
+type MeshFormat int
+
+// These are the mesh formats that can be read and written.
+const (
+	// AutoMeshFormat tells ReadMeshFormat to detect the format itself.
+	AutoMeshFormat MeshFormat = iota
+
+	// MeshFormatM2 is the current format: an "M2" header, the mesh
+	// dimensions, and one "x y label" line per point, with coordinates
+	// expressed in tenths of a pixel, optionally followed by tagged
+	// sections.
+	MeshFormatM2
+
+	// MeshFormatM1 is an older format: an "M1" header, the mesh
+	// dimensions, and one "x y" line per point, with coordinates
+	// expressed in whole pixels.
+	MeshFormatM1
+
+	// MeshFormatHeaderless is the oldest format: the mesh dimensions
+	// followed by one "x y" line per point, with coordinates expressed
+	// in whole pixels.
+	MeshFormatHeaderless
+)
+
+// String returns the name of a MeshFormat.
+func (f MeshFormat) String() string {
+	switch f {
+	case AutoMeshFormat:
+		return "auto"
+	case MeshFormatM2:
+		return "M2"
+	case MeshFormatM1:
+		return "M1"
+	case MeshFormatHeaderless:
+		return "headerless"
+	}
+	return fmt.Sprintf("MeshFormat(%d)", int(f))
+}
+
+// MeshReadOptions control how ReadMeshOptions parses a mesh file.
+type MeshReadOptions struct {
+	// Format, if not AutoMeshFormat, requires that the mesh file be of
+	// the given format.
+	Format MeshFormat
+
+	// Strict rejects data lines containing extra tokens, non-integer
+	// coordinates, missing labels, and text following the mesh data that
+	// does not begin a tagged (<...>) section.  Non-strict parsing
+	// ignores all of these.
+	Strict bool
+}
+
+// A meshToken is a whitespace-separated token and its 1-based column.
+type meshToken struct {
+	text string
+	col  int
+}
+
+// A meshLineReader reads a mesh file line by line, skipping blank lines and
+// comments and tolerating CRLF line endings and arbitrarily long lines.
+type meshLineReader struct {
+	rd   *bufio.Reader // Underlying reader
+	line int           // Number of the most recently read line
+}
+
+// newMeshLineReader wraps an io.Reader with a meshLineReader.
+func newMeshLineReader(r io.Reader) *meshLineReader {
+	return &meshLineReader{rd: bufio.NewReader(r)}
+}
+
+// next returns the tokens on the next line that is neither blank nor a
+// comment (a line whose first non-blank character is "#").  It returns io.EOF
+// if no such line exists.
+func (lr *meshLineReader) next() ([]meshToken, error) {
+	for {
+		ln, err := lr.rd.ReadString('\n')
+		if err != nil && (err != io.EOF || ln == "") {
+			return nil, err
+		}
+		lr.line++
+		toks := splitMeshLine(ln)
+		if len(toks) == 0 || strings.HasPrefix(toks[0].text, "#") {
+			continue
+		}
+		return toks, nil
+	}
+}
+
+// splitMeshLine splits a line into whitespace-separated tokens, recording the
+// column at which each token begins.
+func splitMeshLine(ln string) []meshToken {
+	var toks []meshToken
+	start := -1
+	for i, ch := range ln + " " {
+		isSpace := ch == ' ' || ch == '\t' || ch == '\r' || ch == '\n' || ch == '\v' || ch == '\f'
+		switch {
+		case isSpace && start >= 0:
+			toks = append(toks, meshToken{text: ln[start:i], col: start + 1})
+			start = -1
+		case !isSpace && start < 0:
+			start = i
+		}
+	}
+	return toks
+}
+
+// lineError returns a MeshParseError that refers to an entire line.
+func (lr *meshLineReader) lineError(field string, toks []meshToken, err error) *MeshParseError {
+	frags := make([]string, len(toks))
+	for i, t := range toks {
+		frags[i] = t.text
+	}
+	return &MeshParseError{
+		Line:  lr.line,
+		Field: field,
+		Text:  strings.Join(frags, " "),
+		Err:   err,
+	}
+}
+
+// tokenError returns a MeshParseError that refers to a single token.
+func (lr *meshLineReader) tokenError(field string, tok meshToken, err error) *MeshParseError {
+	return &MeshParseError{
+		Line:   lr.line,
+		Column: tok.col,
+		Field:  field,
+		Text:   tok.text,
+		Err:    err,
+	}
+}
+
+// readError returns a MeshParseError that indicates a failure to read a line.
+// io.EOF is reported as io.ErrUnexpectedEOF unless eofOK is true.
+func (lr *meshLineReader) readError(field string, err error, eofOK bool) *MeshParseError {
+	if err == io.EOF && !eofOK {
+		err = io.ErrUnexpectedEOF
+	}
+	return &MeshParseError{
+		Line:  lr.line + 1,
+		Field: field,
+		Err:   err,
+	}
+}
@@ -0,0 +1,152 @@
+// This file provides functions for mirroring meshes and for editing meshes
+// symmetrically.
+
+package xmorph
+
+import "fmt"
+
+// A meshSymmetry describes the line about which a mesh is kept symmetric.
+type meshSymmetry struct {
+	d    Direction // Vertical = mirror columns about x = axis; Horizontal = mirror rows about y = axis
+	axis float64   // Coordinate of the line of symmetry
+}
+
+// mirrorPoint returns the mirror image of a point about a vertical
+// (x = axis) or horizontal (y = axis) line.
+func mirrorPoint(p Point, d Direction, axis float64) Point {
+	if d == Vertical {
+		return Point{X: 2*axis - p.X, Y: p.Y}
+	}
+	return Point{X: p.X, Y: 2*axis - p.Y}
+}
+
+// checkDirection returns an error if d is not a valid Direction.
+func checkDirection(d Direction) error {
+	if d != Vertical && d != Horizontal {
+		return fmt.Errorf("unexpected direction %d", d)
+	}
+	return nil
+}
+
+// Mirror returns a new mesh that is the mirror image of m about a vertical
+// line, x = axis (if d is Vertical), or a horizontal line, y = axis (if d is
+// Horizontal).  Columns (respectively, rows) are reversed so that the result
+// is a valid grid with the same dimensions as m, and labels move with their
+// points.  Mirroring a mesh for a w×h image about x = (w-1)/2 or
+// y = (h-1)/2 keeps its edges on the image boundary.
+func (m *Mesh) Mirror(d Direction, axis float64) (*Mesh, error) {
+	if err := checkDirection(d); err != nil {
+		return nil, err
+	}
+	pts, labels := m.Points(), m.meshLabels()
+	if d == Horizontal {
+		pts, labels = transposeGrid(pts, labels)
+	}
+	mPts := make([][]Point, len(pts))
+	mLabels := make([][]int, len(pts))
+	for r, row := range pts {
+		n := len(row)
+		mPts[r] = make([]Point, n)
+		mLabels[r] = make([]int, n)
+		for c, pt := range row {
+			// Transposition swapped x and y, so a vertical reflection
+			// is correct in both cases.
+			mPts[r][n-1-c] = mirrorPoint(pt, Vertical, axis)
+			mLabels[r][n-1-c] = labels[r][c]
+		}
+	}
+	if d == Horizontal {
+		mPts, mLabels = transposeGrid(mPts, mLabels)
+	}
+	return meshFromGrid(mPts, mLabels), nil
+}
+
+// mirrorPartner returns the column and row of the point that mirrors the
+// point at (x, y) under the mesh's symmetry.
+func (m *Mesh) mirrorPartner(x, y int) (int, int) {
+	if m.sym.d == Vertical {
+		return m.NX - 1 - x, y
+	}
+	return x, m.NY - 1 - y
+}
+
+// EnableSymmetry puts the mesh in a symmetric-editing mode, in which Set and
+// SetImagePoint also move each point's mirrored partner to the point's mirror
+// image.  If d is Vertical, the mirror is the line x = axis, and the
+// partner of the point at column c is the point at column NX-1-c of the same
+// row.  If d is Horizontal, the mirror is the line y = axis, and the partner
+// of the point at row r is the point at row NY-1-r of the same column.  A
+// point in the middle column (or row) is its own partner and is constrained
+// to lie on the line of symmetry.  Transform and the smoothing methods move
+// each pair of partners to the average of one point and the mirror image of
+// the other, and a point pinned by SmoothOptions also pins its partner.
+// AddLine and DeleteLine, which would break the pairing of partners, return
+// an error in symmetric-editing mode.  EnableSymmetry does not modify
+// existing points; Mirror and InterpolateMeshes can be used to symmetrize a
+// mesh first.
+func (m *Mesh) EnableSymmetry(d Direction, axis float64) error {
+	if err := checkDirection(d); err != nil {
+		return err
+	}
+	m.sym = &meshSymmetry{d: d, axis: axis}
+	return nil
+}
+
+// DisableSymmetry ends symmetric-editing mode.
+func (m *Mesh) DisableSymmetry() {
+	m.sym = nil
+}
+
+// setSymmetric assigns the point at (x, y) and its mirrored partner.  Both
+// changes are recorded as a single step in the mesh's edit history.
+func (m *Mesh) setSymmetric(x, y int, pt Point) {
+	m.checkMeshCoord(x, y)
+	px, py := m.mirrorPartner(x, y)
+	if px == x && py == y {
+		// Constrain a self-partnered point to the line of symmetry.
+		if m.sym.d == Vertical {
+			pt.X = m.sym.axis
+		} else {
+			pt.Y = m.sym.axis
+		}
+		m.setRecorded(x, y, pt)
+		return
+	}
+	m.BeginTransaction()
+	defer m.EndTransaction()
+	m.setRecorded(x, y, pt)
+	m.setRecorded(px, py, mirrorPoint(pt, m.sym.d, m.sym.axis))
+}
+
+// symmetrize makes the points in a 2-D slice that mv marks as movable
+// symmetric under the mesh's symmetry.  Each movable point whose partner is
+// also movable is moved to the average of itself and its partner's mirror
+// image, and its partner is moved to the mirror image of that.  A movable
+// point that is its own partner is moved onto the line of symmetry.  Each
+// move is made by calling move, which may veto it; if either move of a pair
+// is vetoed, both points are left where they were.
+func (m *Mesh) symmetrize(pts [][]Point, mv [][]bool, move func(r, c int, p Point) bool) {
+	s := m.sym
+	for r, row := range pts {
+		for c := range row {
+			pc, pr := m.mirrorPartner(c, r)
+			if !mv[r][c] || !mv[pr][pc] || pr > r || (pr == r && pc > c) {
+				continue // Immovable or visited as a partner
+			}
+			p, q := pts[r][c], pts[pr][pc]
+			if pc == c && pr == r {
+				if s.d == Vertical {
+					p.X = s.axis
+				} else {
+					p.Y = s.axis
+				}
+				move(r, c, p)
+				continue
+			}
+			a := p.Add(mirrorPoint(q, s.d, s.axis)).Div(2.0)
+			if move(r, c, a) && !move(pr, pc, mirrorPoint(a, s.d, s.axis)) {
+				pts[r][c] = p
+			}
+		}
+	}
+}
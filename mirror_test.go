@@ -0,0 +1,185 @@
+// The functions defined in this file ensure the xmorph package's mirroring
+// and symmetric-editing operations work as expected.
+
+package xmorph
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// TestMirror ensures that mirroring reflects points, reverses columns or
+// rows, moves labels, and is its own inverse.
+func TestMirror(t *testing.T) {
+	const nx, ny, wd, ht = 7, 6, 140, 100
+	rng := rand.New(rand.NewSource(47))
+	m := jaggedMesh(rng, nx, ny, wd, ht, 0.3)
+	defer m.Free()
+	m.SetLabel(1, 2, 5)
+	for _, d := range []Direction{Vertical, Horizontal} {
+		axis := float64(wd-1) / 2
+		if d == Horizontal {
+			axis = float64(ht-1) / 2
+		}
+		mm, err := m.Mirror(d, axis)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mm.Free()
+		if rep := mm.Validate(wd, ht); !rep.OK() {
+			t.Fatalf("expected a valid mirrored mesh but saw %+v", rep)
+		}
+		for r := 0; r < ny; r++ {
+			for c := 0; c < nx; c++ {
+				mc, mr := nx-1-c, r
+				if d == Horizontal {
+					mc, mr = c, ny-1-r
+				}
+				want := mirrorPoint(m.Get(c, r), d, axis)
+				if p := mm.Get(mc, mr); !p.Eq(want, 1e-9) {
+					t.Fatalf("expected %v at (%d, %d) but saw %v", want, mc, mr, p)
+				}
+				if a, b := m.GetLabel(c, r), mm.GetLabel(mc, mr); a != b {
+					t.Fatalf("expected label %d at (%d, %d) but saw %d", a, mc, mr, b)
+				}
+			}
+		}
+
+		// Mirroring twice should restore the original mesh.
+		m2, err := mm.Mirror(d, axis)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer m2.Free()
+		if d, _ := MaxDisplacement(m, m2); d > 1e-9 {
+			t.Fatalf("expected mirroring twice to restore the mesh but saw a displacement of %v", d)
+		}
+	}
+	if _, err := m.Mirror(Direction(3), 0); err == nil {
+		t.Fatal("expected an invalid direction to be rejected")
+	}
+}
+
+// TestSymmetricEditing ensures that Set updates a point's mirrored partner
+// in symmetric-editing mode and that both changes are undone together.
+func TestSymmetricEditing(t *testing.T) {
+	m := NewRegularMesh(5, 6, 101, 101)
+	defer m.Free()
+	m.EnableHistory(0)
+	if err := m.EnableSymmetry(Vertical, 50); err != nil {
+		t.Fatal(err)
+	}
+	m.Set(1, 2, Point{X: 20, Y: 45})
+	if p := m.Get(3, 2); !p.Eq(Point{X: 80, Y: 45}, 1e-9) {
+		t.Fatalf("expected (80, 45) but saw %v", p)
+	}
+
+	// A point in the middle column is constrained to the axis.
+	m.Set(2, 3, Point{X: 53, Y: 61})
+	if p := m.Get(2, 3); !p.Eq(Point{X: 50, Y: 61}, 1e-9) {
+		t.Fatalf("expected (50, 61) but saw %v", p)
+	}
+
+	// Undo reverts a point and its partner together.
+	if err := m.Undo(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Undo(); err != nil {
+		t.Fatal(err)
+	}
+	if p, q := m.Get(1, 2), m.Get(3, 2); !p.Eq(Point{X: 25, Y: 40}, 1e-9) || !q.Eq(Point{X: 75, Y: 40}, 1e-9) {
+		t.Fatalf("expected (25, 40) and (75, 40) but saw %v and %v", p, q)
+	}
+
+	// Horizontal symmetry pairs rows.
+	if err := m.EnableSymmetry(Horizontal, 50); err != nil {
+		t.Fatal(err)
+	}
+	m.Set(1, 1, Point{X: 22, Y: 18})
+	if p := m.Get(1, 4); !p.Eq(Point{X: 22, Y: 82}, 1e-9) {
+		t.Fatalf("expected (22, 82) but saw %v", p)
+	}
+
+	// Transforming a symmetric mesh symmetrically keeps it symmetric.
+	m.Transform(NewScaling(1.1, 1.1, Point{X: 50, Y: 50}), true)
+	for r := 1; r < 5; r++ {
+		for c := 1; c < 4; c++ {
+			if p, q := m.Get(c, r), mirrorPoint(m.Get(c, 5-r), Horizontal, 50); !p.Eq(q, 1e-9) {
+				t.Fatalf("expected %v at (%d, %d) but saw %v", q, c, r, p)
+			}
+		}
+	}
+
+	// Edits are independent once symmetry is disabled.
+	m.DisableSymmetry()
+	q := m.Get(1, 4)
+	m.Set(1, 1, Point{X: 20, Y: 20})
+	if p := m.Get(1, 4); p != q {
+		t.Fatalf("expected the partner to remain at %v but saw %v", q, p)
+	}
+	if err := m.EnableSymmetry(Direction(0), 0); err == nil {
+		t.Fatal("expected an invalid direction to be rejected")
+	}
+}
+
+// TestSymmetricBulkEdits ensures that smoothing and transformation keep a
+// mesh symmetric in symmetric-editing mode, that pins apply to both members
+// of a pair, and that adding or deleting lines is rejected.
+func TestSymmetricBulkEdits(t *testing.T) {
+	const nx, ny, wd, ht = 7, 6, 121, 101
+	rng := rand.New(rand.NewSource(47))
+	jm := jaggedMesh(rng, nx, ny, wd, ht, 0.3)
+	defer jm.Free()
+	mj, err := jm.Mirror(Vertical, 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mj.Free()
+	m, err := InterpolateMeshes(jm, mj, 0.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Free()
+	if err := m.EnableSymmetry(Vertical, 60); err != nil {
+		t.Fatal(err)
+	}
+	symmetric := func(what string) {
+		for r := 0; r < ny; r++ {
+			for c := 0; c < nx; c++ {
+				if p, q := m.Get(c, r), mirrorPoint(m.Get(nx-1-c, r), Vertical, 60); !p.Eq(q, 1e-9) {
+					t.Fatalf("%s: expected %v at (%d, %d) but saw %v", what, q, c, r, p)
+				}
+			}
+		}
+	}
+
+	// Pinning a point also pins its partner.
+	pinned := make([][]bool, ny)
+	for r := range pinned {
+		pinned[r] = make([]bool, nx)
+	}
+	pinned[2][1] = true
+	p, q := m.Get(1, 2), m.Get(nx-2, 2)
+	if err := m.SmoothLaplacian(SmoothOptions{Iterations: 5, Strength: 0.5, Pinned: pinned}); err != nil {
+		t.Fatal(err)
+	}
+	if m.Get(1, 2) != p || m.Get(nx-2, 2) != q {
+		t.Fatal("expected a pinned point and its partner not to move")
+	}
+	symmetric("SmoothLaplacian")
+	if rep := m.Validate(wd, ht); !rep.OK() {
+		t.Fatalf("expected a valid mesh but saw %+v", rep)
+	}
+
+	// An asymmetric transformation is symmetrized.
+	m.Transform(NewTranslation(3, 1), true)
+	symmetric("Transform")
+
+	// Lines cannot be added or deleted.
+	if err := m.AddLine(1, 0.5, Vertical); err == nil {
+		t.Fatal("expected AddLine to fail in symmetric-editing mode")
+	}
+	if err := m.DeleteLine(1, Horizontal); err == nil {
+		t.Fatal("expected DeleteLine to fail in symmetric-editing mode")
+	}
+}
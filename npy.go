@@ -0,0 +1,176 @@
+// This file provides functions for reading and writing meshes as NumPy .npy
+// arrays.
+
+package xmorph
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// npyMagic is the magic string that begins every .npy file.
+const npyMagic = "\x93NUMPY"
+
+// WriteNPY outputs a mesh as a NumPy .npy file containing a float64 array of
+// shape (NY, NX, 2), where element [r, c, 0] is the x coordinate of the point
+// in row r, column c and element [r, c, 1] is its y coordinate.  Labels are
+// not written.
+func (m *Mesh) WriteNPY(w io.Writer) error {
+	// Construct a version 1.0 header, padded so the data are 64-byte
+	// aligned.
+	nx, ny := m.NX, m.NY
+	hdr := fmt.Sprintf("{'descr': '<f8', 'fortran_order': False, 'shape': (%d, %d, 2), }", ny, nx)
+	hLen := len(npyMagic) + 4 + len(hdr) + 1
+	hdr += strings.Repeat(" ", (64-hLen%64)%64) + "\n"
+	if len(hdr) > math.MaxUint16 {
+		return fmt.Errorf("NumPy header is too long")
+	}
+	var buf bytes.Buffer
+	buf.WriteString(npyMagic)
+	buf.Write([]byte{1, 0})
+	binary.Write(&buf, binary.LittleEndian, uint16(len(hdr)))
+	buf.WriteString(hdr)
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return err
+	}
+
+	// Write the data in row-major order.
+	data := make([]float64, 0, nx*ny*2)
+	for _, row := range m.Points() {
+		for _, pt := range row {
+			data = append(data, pt.X, pt.Y)
+		}
+	}
+	return binary.Write(w, binary.LittleEndian, data)
+}
+
+// These regular expressions extract fields from a .npy header.
+var (
+	npyDescrRE   = regexp.MustCompile(`'descr'\s*:\s*'([^']*)'`)
+	npyFortranRE = regexp.MustCompile(`'fortran_order'\s*:\s*(True|False)`)
+	npyShapeRE   = regexp.MustCompile(`'shape'\s*:\s*\(([^)]*)\)`)
+)
+
+// ReadMeshNPY reads a mesh from a NumPy .npy file containing a float64 array
+// of shape (NY, NX, 2), as written by WriteNPY.  Both byte orders and both C
+// and Fortran element orders are accepted.
+func ReadMeshNPY(r io.Reader) (*Mesh, error) {
+	// Read and validate the preamble.
+	pre := make([]byte, len(npyMagic)+2)
+	if _, err := io.ReadFull(r, pre); err != nil {
+		return nil, fmt.Errorf("failed to read the NumPy preamble (%w)", err)
+	}
+	if string(pre[:len(npyMagic)]) != npyMagic {
+		return nil, fmt.Errorf("not a NumPy .npy file")
+	}
+	var hLen int
+	switch major := pre[len(npyMagic)]; major {
+	case 1:
+		var n uint16
+		if err := binary.Read(r, binary.LittleEndian, &n); err != nil {
+			return nil, fmt.Errorf("failed to read the NumPy header length (%w)", err)
+		}
+		hLen = int(n)
+	case 2, 3:
+		var n uint32
+		if err := binary.Read(r, binary.LittleEndian, &n); err != nil {
+			return nil, fmt.Errorf("failed to read the NumPy header length (%w)", err)
+		}
+		if n > 1<<20 {
+			return nil, fmt.Errorf("NumPy header length %d is implausibly large", n)
+		}
+		hLen = int(n)
+	default:
+		return nil, fmt.Errorf("unsupported NumPy format version %d", major)
+	}
+	hdrBytes := make([]byte, hLen)
+	if _, err := io.ReadFull(r, hdrBytes); err != nil {
+		return nil, fmt.Errorf("failed to read the NumPy header (%w)", err)
+	}
+	hdr := string(hdrBytes)
+
+	// Parse the header.
+	var order binary.ByteOrder
+	match := npyDescrRE.FindStringSubmatch(hdr)
+	switch {
+	case match == nil:
+		return nil, fmt.Errorf("NumPy header lacks a descr field")
+	case match[1] == "<f8":
+		order = binary.LittleEndian
+	case match[1] == ">f8":
+		order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("unsupported NumPy data type %q (expected float64)", match[1])
+	}
+	match = npyFortranRE.FindStringSubmatch(hdr)
+	if match == nil {
+		return nil, fmt.Errorf("NumPy header lacks a fortran_order field")
+	}
+	fortran := match[1] == "True"
+	match = npyShapeRE.FindStringSubmatch(hdr)
+	if match == nil {
+		return nil, fmt.Errorf("NumPy header lacks a shape field")
+	}
+	var shape []int
+	for _, s := range strings.Split(match[1], ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse NumPy shape %q (%w)", match[1], err)
+		}
+		shape = append(shape, n)
+	}
+	if len(shape) != 3 || shape[2] != 2 {
+		return nil, fmt.Errorf("NumPy array has shape (%s) but must have shape (ny, nx, 2)", match[1])
+	}
+	ny, nx := shape[0], shape[1]
+	if nx < 4 || ny < 4 {
+		return nil, fmt.Errorf("mesh must be at least 4x4 (read %dx%d)", nx, ny)
+	}
+	if int64(nx)*int64(ny) > 1<<32 {
+		return nil, fmt.Errorf("a %dx%d mesh is implausibly large", nx, ny)
+	}
+
+	// Read the data.  We read all remaining bytes rather than allocating
+	// based on the header so a corrupt shape cannot exhaust memory.
+	var data bytes.Buffer
+	if _, err := data.ReadFrom(io.LimitReader(r, int64(nx)*int64(ny)*16)); err != nil {
+		return nil, fmt.Errorf("failed to read NumPy data (%w)", err)
+	}
+	raw := data.Bytes()
+	if len(raw) != nx*ny*16 {
+		return nil, fmt.Errorf("failed to read NumPy data (%w)", io.ErrUnexpectedEOF)
+	}
+	sl := make([][]Point, ny)
+	for j := range sl {
+		sl[j] = make([]Point, nx)
+		for i := range sl[j] {
+			var xi, yi int
+			if fortran {
+				xi = j + ny*i
+				yi = xi + ny*nx
+			} else {
+				xi = (j*nx + i) * 2
+				yi = xi + 1
+			}
+			pt := Point{
+				X: math.Float64frombits(order.Uint64(raw[xi*8:])),
+				Y: math.Float64frombits(order.Uint64(raw[yi*8:])),
+			}
+			if math.IsNaN(pt.X) || math.IsInf(pt.X, 0) || math.IsNaN(pt.Y) || math.IsInf(pt.Y, 0) {
+				return nil, fmt.Errorf("NumPy array specifies a non-finite coordinate at row %d, column %d", j, i)
+			}
+			sl[j][i] = pt
+		}
+	}
+	return MeshFromPoints(sl), nil
+}
@@ -0,0 +1,95 @@
+// The functions defined in this file ensure the xmorph package's NumPy
+// operations work as expected.
+
+package xmorph
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// TestNPYRoundTrip ensures that a mesh written with WriteNPY can be read back
+// with ReadMeshNPY.
+func TestNPYRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(31))
+	m1 := MeshFromPoints(random2DPoints(rng, 9, 6))
+	defer m1.Free()
+	var buf bytes.Buffer
+	if err := m1.WriteNPY(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// Ensure the header matches what NumPy itself would write.
+	expected := "\x93NUMPY\x01\x00\x76\x00{'descr': '<f8', 'fortran_order': False, 'shape': (6, 9, 2), }"
+	if !bytes.HasPrefix(buf.Bytes(), []byte(expected)) {
+		t.Fatalf("expected a header beginning with %q but saw %q", expected, buf.Bytes()[:len(expected)])
+	}
+	if buf.Len() != 128+9*6*2*8 {
+		t.Fatalf("expected %d bytes but saw %d", 128+9*6*2*8, buf.Len())
+	}
+
+	// Read back the mesh.
+	m2, err := ReadMeshNPY(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m2.Free()
+	validateMeshDimens(t, m2, 9, 6)
+	comparePointSlices(t, m1.Points(), m2.Points())
+}
+
+// TestReadMeshNPYFortran ensures that ReadMeshNPY can read big-endian,
+// Fortran-ordered arrays.
+func TestReadMeshNPYFortran(t *testing.T) {
+	const nx, ny = 5, 4
+	hdr := "{'descr': '>f8', 'fortran_order': True, 'shape': (4, 5, 2), }\n"
+	var buf bytes.Buffer
+	buf.WriteString("\x93NUMPY\x02\x00")
+	binary.Write(&buf, binary.LittleEndian, uint32(len(hdr)))
+	buf.WriteString(hdr)
+	data := make([]float64, nx*ny*2)
+	for k := 0; k < 2; k++ {
+		for i := 0; i < nx; i++ {
+			for j := 0; j < ny; j++ {
+				v := float64(i * 10)
+				if k == 1 {
+					v = float64(j * 100)
+				}
+				data[j+ny*i+ny*nx*k] = v
+			}
+		}
+	}
+	binary.Write(&buf, binary.BigEndian, data)
+	b := buf.Bytes()
+	m, err := ReadMeshNPY(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Free()
+	for j := 0; j < ny; j++ {
+		for i := 0; i < nx; i++ {
+			exp := Point{X: float64(i * 10), Y: float64(j * 100)}
+			if pt := m.Get(i, j); pt != exp {
+				t.Fatalf("expected (%d, %d) = %v but saw %v", i, j, exp, pt)
+			}
+		}
+	}
+
+	// Ensure that truncated data are rejected.
+	_, err = ReadMeshNPY(bytes.NewReader(b[:len(b)-8]))
+	if err == nil {
+		t.Fatal("expected truncated data to be rejected")
+	}
+
+	// Ensure that non-finite coordinates are rejected.
+	for _, v := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		bad := append([]byte(nil), b...)
+		binary.BigEndian.PutUint64(bad[len(b)-8*7:], math.Float64bits(v))
+		if _, err := ReadMeshNPY(bytes.NewReader(bad)); err == nil {
+			t.Fatalf("expected a coordinate of %v to be rejected", v)
+		}
+	}
+}
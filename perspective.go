@@ -0,0 +1,60 @@
+// This file provides functions for constructing meshes that apply or undo a
+// perspective distortion, such as for rectifying photographed documents or
+// keystone-correcting a projector.
+
+package xmorph
+
+import "fmt"
+
+// NewPerspectiveMeshes returns a regular nx×ny mesh over a wd×ht image and
+// a compatible mesh whose points are those of the regular mesh transformed
+// by the homography that maps the image's corners to the given corners.
+// The corners must be listed in the order upper left, upper right, lower
+// right, lower left, must form a convex quadrilateral, and must lie within
+// the image, as the perspective mesh could not otherwise pass Validate.  To
+// rectify a photographed document whose corners were given, warp the
+// photograph from the perspective mesh to the regular mesh.  To pre-distort
+// an image so that it appears rectangular when projected onto a skewed
+// surface, warp it from the regular mesh to the perspective mesh.
+//
+// Because libmorph requires mesh edges to lie on the image boundary, points
+// on the perspective mesh's outer rows and columns are moved to the
+// boundary, so the warp is projective only in the mesh's interior.  Denser
+// meshes confine the approximation to a thinner border.
+func NewPerspectiveMeshes(corners [4]Point, nx, ny, wd, ht int) (*Mesh, *Mesh, error) {
+	if nx < 4 || ny < 4 {
+		return nil, nil, fmt.Errorf("mesh must be at least 4x4 (requested %dx%d)", nx, ny)
+	}
+
+	// Ensure the corners lie within the image.
+	w1, h1 := float64(wd-1), float64(ht-1)
+	for i, c := range corners {
+		if c.X < 0.0 || c.Y < 0.0 || c.X > w1 || c.Y > h1 {
+			return nil, nil, fmt.Errorf("corner %d, %v, lies outside the %dx%d image", i, c, wd, ht)
+		}
+	}
+
+	// Ensure the corners form a convex quadrilateral in clockwise screen
+	// order.
+	for i := range corners {
+		a, b, c := corners[i], corners[(i+1)%4], corners[(i+2)%4]
+		if cross(a, b, c) <= 0.0 {
+			return nil, nil, fmt.Errorf("corners %v do not form a convex quadrilateral listed clockwise from the upper left", corners)
+		}
+	}
+
+	// Map the image corners to the given corners.
+	imgCorners := []Point{{X: 0, Y: 0}, {X: w1, Y: 0}, {X: w1, Y: h1}, {X: 0, Y: h1}}
+	h, err := FitHomography(imgCorners, corners[:])
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to construct perspective meshes (%w)", err)
+	}
+	reg := NewRegularMesh(nx, ny, wd, ht)
+	rp := reg.Points()
+	pp := make([][]Point, ny)
+	for r, row := range rp {
+		pp[r] = applyAll(h, row)
+	}
+	snapEdges(pp, rp)
+	return reg, MeshFromPoints(pp), nil
+}
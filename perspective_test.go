@@ -0,0 +1,84 @@
+// The functions defined in this file ensure the xmorph package's perspective
+// meshes work as expected.
+
+package xmorph
+
+import (
+	"math"
+	"testing"
+)
+
+// TestNewPerspectiveMeshes ensures that the perspective mesh follows the
+// homography defined by the four corners and that warping from the
+// perspective mesh to the regular mesh approximately rectifies the
+// quadrilateral.
+func TestNewPerspectiveMeshes(t *testing.T) {
+	const nx, ny, wd, ht = 41, 31, 401, 301
+	corners := [4]Point{{X: 60, Y: 40}, {X: 350, Y: 20}, {X: 380, Y: 270}, {X: 30, Y: 250}}
+	reg, persp, err := NewPerspectiveMeshes(corners, nx, ny, wd, ht)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reg.Free()
+	defer persp.Free()
+	if rep := persp.Validate(wd, ht); !rep.OK() {
+		t.Fatalf("expected a valid perspective mesh but saw %+v", rep)
+	}
+
+	// Interior points should lie exactly where the homography puts them.
+	imgCorners := []Point{{X: 0, Y: 0}, {X: wd - 1, Y: 0}, {X: wd - 1, Y: ht - 1}, {X: 0, Y: ht - 1}}
+	h, err := FitHomography(imgCorners, corners[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for r := 1; r < ny-1; r++ {
+		for c := 1; c < nx-1; c++ {
+			if p, q := persp.Get(c, r), h.Apply(reg.Get(c, r)); !p.Eq(q, 1e-6) {
+				t.Fatalf("expected %v at (%d, %d) but saw %v", q, c, r, p)
+			}
+		}
+	}
+
+	// Rectification should map points well inside the quadrilateral to
+	// their projectively correct locations.
+	hInv, err := h.Inverse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mm, err := NewMeshMapping(persp, reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	worst := 0.0
+	for y := 60.0; y <= 240.0; y += 7.0 {
+		for x := 80.0; x <= 330.0; x += 7.0 {
+			p := Point{X: x, Y: y}
+			q, want := mm.Map(p), hInv.Apply(p)
+			worst = math.Max(worst, math.Hypot(q.X-want.X, q.Y-want.Y))
+		}
+	}
+	if worst > 0.5 {
+		t.Fatalf("expected rectification to be accurate to 0.5 pixels but saw an error of %.3g", worst)
+	}
+}
+
+// TestNewPerspectiveMeshesErrors ensures that invalid corners and corners
+// outside the image are rejected.
+func TestNewPerspectiveMeshesErrors(t *testing.T) {
+	bad := [][4]Point{
+		{{X: 350, Y: 20}, {X: 60, Y: 40}, {X: 30, Y: 250}, {X: 380, Y: 270}}, // Counterclockwise
+		{{X: 60, Y: 40}, {X: 380, Y: 270}, {X: 350, Y: 20}, {X: 30, Y: 250}}, // Self-intersecting
+		{{X: 0, Y: 0}, {X: 100, Y: 0}, {X: 200, Y: 0}, {X: 0, Y: 100}},       // Collinear
+		{{X: -5, Y: 10}, {X: 390, Y: 0}, {X: 399, Y: 299}, {X: 0, Y: 299}},   // Left of the image
+		{{X: 0, Y: 0}, {X: 399, Y: 0}, {X: 399, Y: 300}, {X: 0, Y: 299}},     // Below the image
+	}
+	for _, corners := range bad {
+		if _, _, err := NewPerspectiveMeshes(corners, 5, 5, 400, 300); err == nil {
+			t.Fatalf("expected corners %v to be rejected", corners)
+		}
+	}
+	good := [4]Point{{X: 0, Y: 0}, {X: 299, Y: 0}, {X: 299, Y: 299}, {X: 0, Y: 299}}
+	if _, _, err := NewPerspectiveMeshes(good, 3, 5, 300, 300); err == nil {
+		t.Fatal("expected a too-small mesh to be rejected")
+	}
+}
@@ -0,0 +1,323 @@
+// This file provides functions for finding the mesh points, cells, and lines
+// that lie at or near a given location, as a mesh editor needs to do to
+// determine what lies under the mouse pointer.
+
+package xmorph
+
+import (
+	"image"
+	"math"
+	"sort"
+)
+
+// A meshIndex is a spatial index of a mesh's points and cells.  It divides
+// the mesh's bounding box into square buckets and records which points and
+// which cells (by bounding box) overlap each bucket.
+type meshIndex struct {
+	pts    [][]Point // Mesh points, indexed [row][column]
+	nx, ny int       // Mesh dimensions
+	origin Point     // Upper-left corner of the bucket grid
+	size   float64   // Width and height of a bucket
+	gx, gy int       // Number of buckets in each direction
+	verts  [][]int   // Points in each bucket (as row*nx + column)
+	cells  [][]int   // Cells overlapping each bucket (as row*(nx-1) + column)
+}
+
+// newMeshIndex constructs a spatial index from a mesh's points.  Buckets are
+// sized to hold about one point each.
+func newMeshIndex(pts [][]Point) *meshIndex {
+	ny, nx := len(pts), len(pts[0])
+	ul, lr := pts[0][0], pts[0][0]
+	for _, row := range pts {
+		for _, p := range row {
+			ul.X = math.Min(ul.X, p.X)
+			ul.Y = math.Min(ul.Y, p.Y)
+			lr.X = math.Max(lr.X, p.X)
+			lr.Y = math.Max(lr.Y, p.Y)
+		}
+	}
+	wd, ht := lr.X-ul.X, lr.Y-ul.Y
+	n := float64(nx * ny)
+	size := math.Max(math.Sqrt(wd*ht/n), math.Max(wd, ht)/n)
+	if size <= 0.0 {
+		size = 1.0
+	}
+	ix := &meshIndex{
+		pts:    pts,
+		nx:     nx,
+		ny:     ny,
+		origin: ul,
+		size:   size,
+		gx:     int(wd/size) + 1,
+		gy:     int(ht/size) + 1,
+	}
+	ix.verts = make([][]int, ix.gx*ix.gy)
+	ix.cells = make([][]int, ix.gx*ix.gy)
+
+	// Bucket each point.
+	for r, row := range pts {
+		for c, p := range row {
+			i, j := ix.bucket(p)
+			b := j*ix.gx + i
+			ix.verts[b] = append(ix.verts[b], r*nx+c)
+		}
+	}
+
+	// Bucket each cell by its bounding box.
+	for r := 0; r < ny-1; r++ {
+		for c := 0; c < nx-1; c++ {
+			q := ix.cell(c, r)
+			cul, clr := q[0], q[0]
+			for _, p := range q[1:] {
+				cul.X = math.Min(cul.X, p.X)
+				cul.Y = math.Min(cul.Y, p.Y)
+				clr.X = math.Max(clr.X, p.X)
+				clr.Y = math.Max(clr.Y, p.Y)
+			}
+			i0, j0 := ix.bucket(cul)
+			i1, j1 := ix.bucket(clr)
+			for j := j0; j <= j1; j++ {
+				for i := i0; i <= i1; i++ {
+					b := j*ix.gx + i
+					ix.cells[b] = append(ix.cells[b], r*(nx-1)+c)
+				}
+			}
+		}
+	}
+	return ix
+}
+
+// bucket returns the column and row of the bucket containing a point.
+// Points outside the bucket grid are assigned to the nearest bucket.
+func (ix *meshIndex) bucket(p Point) (int, int) {
+	i := int(math.Floor((p.X - ix.origin.X) / ix.size))
+	j := int(math.Floor((p.Y - ix.origin.Y) / ix.size))
+	return clampInt(i, 0, ix.gx-1), clampInt(j, 0, ix.gy-1)
+}
+
+// cell returns the four corners of the cell whose upper-left point is at
+// (c, r) in clockwise screen order.
+func (ix *meshIndex) cell(c, r int) [4]Point {
+	return [4]Point{ix.pts[r][c], ix.pts[r][c+1], ix.pts[r+1][c+1], ix.pts[r+1][c]}
+}
+
+// nearest returns the item in a set of buckets that lies closest to p
+// according to a distance function, and that distance.  Buckets are
+// searched in rings of increasing size around p until no unsearched bucket
+// can contain a closer item.  Ties are broken in favor of the smaller item
+// number.  nearest returns -1 if there are no items.
+func (ix *meshIndex) nearest(p Point, buckets [][]int, dist func(int) float64) (int, float64) {
+	bi, bj := ix.bucket(p)
+	best, bestD := -1, math.Inf(1)
+	for k := 0; ; k++ {
+		// Search all buckets in ring k.
+		for j := bj - k; j <= bj+k; j++ {
+			if j < 0 || j >= ix.gy {
+				continue
+			}
+			for i := bi - k; i <= bi+k; i++ {
+				if i < 0 || i >= ix.gx {
+					continue
+				}
+				if j != bj-k && j != bj+k && i != bi-k && i != bi+k {
+					continue // Interior of the ring
+				}
+				for _, id := range buckets[j*ix.gx+i] {
+					d := dist(id)
+					if d < bestD || (d == bestD && id < best) {
+						best, bestD = id, d
+					}
+				}
+			}
+		}
+
+		// Stop when no item in an unsearched bucket can be closer.
+		lb := math.Inf(1)
+		if bi-k > 0 {
+			lb = math.Min(lb, math.Max(p.X-(ix.origin.X+float64(bi-k)*ix.size), 0.0))
+		}
+		if bi+k < ix.gx-1 {
+			lb = math.Min(lb, math.Max(ix.origin.X+float64(bi+k+1)*ix.size-p.X, 0.0))
+		}
+		if bj-k > 0 {
+			lb = math.Min(lb, math.Max(p.Y-(ix.origin.Y+float64(bj-k)*ix.size), 0.0))
+		}
+		if bj+k < ix.gy-1 {
+			lb = math.Min(lb, math.Max(ix.origin.Y+float64(bj+k+1)*ix.size-p.Y, 0.0))
+		}
+		if math.IsInf(lb, 1) || bestD <= lb {
+			return best, bestD
+		}
+	}
+}
+
+// segmentDistance returns the distance from p to the line segment ab.
+func segmentDistance(p, a, b Point) float64 {
+	ab, ap := b.Sub(a), p.Sub(a)
+	t := 0.0
+	if l2 := ab.X*ab.X + ab.Y*ab.Y; l2 > 0.0 {
+		t = math.Max(0.0, math.Min(1.0, (ap.X*ab.X+ap.Y*ab.Y)/l2))
+	}
+	q := a.Add(ab.Mul(t))
+	return math.Hypot(p.X-q.X, p.Y-q.Y)
+}
+
+// insidePolygon reports whether p lies inside or on the boundary of a
+// polygon.  Self-intersecting polygons use the even-odd rule.
+func insidePolygon(p Point, poly []Point) bool {
+	in := false
+	for i := range poly {
+		a, b := poly[i], poly[(i+1)%len(poly)]
+		if segmentDistance(p, a, b) <= 1e-9 {
+			return true
+		}
+		if (a.Y > p.Y) != (b.Y > p.Y) && p.X < a.X+(p.Y-a.Y)*(b.X-a.X)/(b.Y-a.Y) {
+			in = !in
+		}
+	}
+	return in
+}
+
+// pickIndex returns the mesh's spatial index, constructing it if necessary.
+// Any change to the mesh's points discards the index.
+func (m *Mesh) pickIndex() *meshIndex {
+	if m.index == nil {
+		m.index = newMeshIndex(m.Points())
+	}
+	return m.index
+}
+
+// Nearest returns the column and row of the mesh point closest to p and the
+// distance from p to that point.
+func (m *Mesh) Nearest(p Point) (col, row int, dist float64) {
+	ix := m.pickIndex()
+	id, d := ix.nearest(p, ix.verts, func(id int) float64 {
+		q := ix.pts[id/ix.nx][id%ix.nx]
+		return math.Hypot(p.X-q.X, p.Y-q.Y)
+	})
+	return id % ix.nx, id / ix.nx, d
+}
+
+// NearestLine returns the mesh column (Vertical) or row (Horizontal)
+// passing closest to p, as a polyline through its mesh points, and the
+// distance from p to that line.  The result can be passed directly to
+// DeleteLine.
+func (m *Mesh) NearestLine(p Point) (i int, d Direction, dist float64) {
+	ix := m.pickIndex()
+	nc := ix.nx - 1
+
+	// edgeDists returns the distance from p to each edge of a cell: top,
+	// right, bottom, and left.
+	edgeDists := func(id int) [4]float64 {
+		q := ix.cell(id%nc, id/nc)
+		var ds [4]float64
+		for k := range q {
+			ds[k] = segmentDistance(p, q[k], q[(k+1)%4])
+		}
+		return ds
+	}
+	id, dist := ix.nearest(p, ix.cells, func(id int) float64 {
+		ds := edgeDists(id)
+		return math.Min(math.Min(ds[0], ds[1]), math.Min(ds[2], ds[3]))
+	})
+
+	// Determine which of the nearest cell's edges is closest.
+	c, r := id%nc, id/nc
+	ds := edgeDists(id)
+	lines := [4]struct {
+		i int
+		d Direction
+	}{{r, Horizontal}, {c + 1, Vertical}, {r + 1, Horizontal}, {c, Vertical}}
+	k := 0
+	for j := range ds {
+		if ds[j] < ds[k] {
+			k = j
+		}
+	}
+	return lines[k].i, lines[k].d, dist
+}
+
+// CellAt returns the cell that contains p, identified by the column and row
+// of its upper-left mesh point.  It returns false if p does not lie within
+// any cell.  If p lies on the boundary of more than one cell (or within more
+// than one cell of a folded mesh), the first in row-major order is returned.
+func (m *Mesh) CellAt(p Point) (image.Point, bool) {
+	ix := m.pickIndex()
+	i := int(math.Floor((p.X - ix.origin.X) / ix.size))
+	j := int(math.Floor((p.Y - ix.origin.Y) / ix.size))
+	if i < 0 || j < 0 || i >= ix.gx || j >= ix.gy {
+		return image.Point{}, false
+	}
+	nc := ix.nx - 1
+	best := -1
+	for _, id := range ix.cells[j*ix.gx+i] {
+		if best != -1 && id > best {
+			continue
+		}
+		q := ix.cell(id%nc, id/nc)
+		if insidePolygon(p, q[:]) {
+			best = id
+		}
+	}
+	if best == -1 {
+		return image.Point{}, false
+	}
+	return image.Point{X: best % nc, Y: best / nc}, true
+}
+
+// selectInBuckets returns, in row-major order, the mesh points that lie in
+// the buckets overlapping the rectangle with corners a and b and that
+// satisfy a predicate.  Points are identified by their column and row.
+func (ix *meshIndex) selectInBuckets(a, b Point, keep func(Point) bool) []image.Point {
+	i0, j0 := ix.bucket(Point{X: math.Min(a.X, b.X), Y: math.Min(a.Y, b.Y)})
+	i1, j1 := ix.bucket(Point{X: math.Max(a.X, b.X), Y: math.Max(a.Y, b.Y)})
+	var ids []int
+	for j := j0; j <= j1; j++ {
+		for i := i0; i <= i1; i++ {
+			for _, id := range ix.verts[j*ix.gx+i] {
+				if keep(ix.pts[id/ix.nx][id%ix.nx]) {
+					ids = append(ids, id)
+				}
+			}
+		}
+	}
+	sort.Ints(ids)
+	sel := make([]image.Point, len(ids))
+	for k, id := range ids {
+		sel[k] = image.Point{X: id % ix.nx, Y: id / ix.nx}
+	}
+	return sel
+}
+
+// SelectRect returns the mesh points that lie within the rectangle with
+// opposite corners a and b, including its boundary.  Points are identified
+// by their column and row and are returned in row-major order.
+func (m *Mesh) SelectRect(a, b Point) []image.Point {
+	ul := Point{X: math.Min(a.X, b.X), Y: math.Min(a.Y, b.Y)}
+	lr := Point{X: math.Max(a.X, b.X), Y: math.Max(a.Y, b.Y)}
+	return m.pickIndex().selectInBuckets(ul, lr, func(p Point) bool {
+		return p.X >= ul.X && p.X <= lr.X && p.Y >= ul.Y && p.Y <= lr.Y
+	})
+}
+
+// SelectLasso returns the mesh points that lie within a polygon, such as
+// one drawn freehand with a lasso tool, including its boundary.  The polygon
+// is closed implicitly, and self-intersecting polygons use the even-odd
+// rule.  Points are identified by their column and row and are returned in
+// row-major order.  SelectLasso returns nil if the polygon has fewer than
+// three vertices.
+func (m *Mesh) SelectLasso(poly []Point) []image.Point {
+	if len(poly) < 3 {
+		return nil
+	}
+	ul, lr := poly[0], poly[0]
+	for _, p := range poly[1:] {
+		ul.X = math.Min(ul.X, p.X)
+		ul.Y = math.Min(ul.Y, p.Y)
+		lr.X = math.Max(lr.X, p.X)
+		lr.Y = math.Max(lr.Y, p.Y)
+	}
+	return m.pickIndex().selectInBuckets(ul, lr, func(p Point) bool {
+		return insidePolygon(p, poly)
+	})
+}
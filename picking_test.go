@@ -0,0 +1,170 @@
+// The functions defined in this file ensure the xmorph package's picking
+// operations work as expected.
+
+package xmorph
+
+import (
+	"image"
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// TestNearest ensures that Nearest and NearestLine agree with a brute-force
+// search, both inside and outside the mesh.
+func TestNearest(t *testing.T) {
+	rng := rand.New(rand.NewSource(46))
+	m := jaggedMesh(rng, 15, 12, 300, 240, 0.4)
+	defer m.Free()
+	pts := m.Points()
+	for n := 0; n < 500; n++ {
+		p := Point{X: rng.Float64()*400 - 50, Y: rng.Float64()*340 - 50}
+
+		// Nearest point
+		col, row, dist := m.Nearest(p)
+		best := math.Inf(1)
+		for _, rw := range pts {
+			for _, q := range rw {
+				best = math.Min(best, math.Hypot(p.X-q.X, p.Y-q.Y))
+			}
+		}
+		if q := pts[row][col]; math.Abs(dist-best) > 1e-9 || math.Abs(math.Hypot(p.X-q.X, p.Y-q.Y)-dist) > 1e-9 {
+			t.Fatalf("expected a distance of %v from %v but saw %v at (%d, %d)", best, p, dist, col, row)
+		}
+
+		// Nearest line
+		i, d, ldist := m.NearestLine(p)
+		best = math.Inf(1)
+		for r := range pts {
+			for c := range pts[r] {
+				if c+1 < len(pts[r]) {
+					best = math.Min(best, segmentDistance(p, pts[r][c], pts[r][c+1]))
+				}
+				if r+1 < len(pts) {
+					best = math.Min(best, segmentDistance(p, pts[r][c], pts[r+1][c]))
+				}
+			}
+		}
+		lineDist := math.Inf(1)
+		switch d {
+		case Vertical:
+			for r := 0; r+1 < len(pts); r++ {
+				lineDist = math.Min(lineDist, segmentDistance(p, pts[r][i], pts[r+1][i]))
+			}
+		case Horizontal:
+			for c := 0; c+1 < len(pts[i]); c++ {
+				lineDist = math.Min(lineDist, segmentDistance(p, pts[i][c], pts[i][c+1]))
+			}
+		default:
+			t.Fatalf("unexpected direction %d", d)
+		}
+		if math.Abs(ldist-best) > 1e-9 || math.Abs(lineDist-best) > 1e-9 {
+			t.Fatalf("expected a line distance of %v from %v but saw %v (line %d, direction %d, distance %v)", best, p, ldist, i, d, lineDist)
+		}
+	}
+}
+
+// TestCellAt ensures that CellAt finds the cell containing a point.
+func TestCellAt(t *testing.T) {
+	rng := rand.New(rand.NewSource(460))
+	m := jaggedMesh(rng, 10, 8, 200, 160, 0.4)
+	defer m.Free()
+	pts := m.Points()
+	for n := 0; n < 500; n++ {
+		p := Point{X: rng.Float64()*240 - 20, Y: rng.Float64()*200 - 20}
+		cell, ok := m.CellAt(p)
+		want, wantOK := image.Point{}, false
+	Search:
+		for r := 0; r+1 < len(pts); r++ {
+			for c := 0; c+1 < len(pts[r]); c++ {
+				q := []Point{pts[r][c], pts[r][c+1], pts[r+1][c+1], pts[r+1][c]}
+				if insidePolygon(p, q) {
+					want, wantOK = image.Point{X: c, Y: r}, true
+					break Search
+				}
+			}
+		}
+		if ok != wantOK || cell != want {
+			t.Fatalf("expected %v (%v) for %v but saw %v (%v)", want, wantOK, p, cell, ok)
+		}
+	}
+
+	// Mesh corners lie within the corner cells.
+	if cell, ok := m.CellAt(Point{X: 199, Y: 159}); !ok || cell != (image.Point{X: 8, Y: 6}) {
+		t.Fatalf("expected cell (8, 6) but saw %v (%v)", cell, ok)
+	}
+}
+
+// TestSelect ensures that rectangle and lasso selection return the points
+// within the selected region.
+func TestSelect(t *testing.T) {
+	m := NewRegularMesh(6, 6, 51, 51)
+	defer m.Free()
+	sel := m.SelectRect(Point{X: 25, Y: 35}, Point{X: 5, Y: 10})
+	want := []image.Point{{X: 1, Y: 1}, {X: 2, Y: 1}, {X: 1, Y: 2}, {X: 2, Y: 2}, {X: 1, Y: 3}, {X: 2, Y: 3}}
+	if !reflect.DeepEqual(sel, want) {
+		t.Fatalf("expected %v but saw %v", want, sel)
+	}
+	if sel := m.SelectRect(Point{X: 100, Y: 100}, Point{X: 200, Y: 200}); len(sel) != 0 {
+		t.Fatalf("expected an empty selection but saw %v", sel)
+	}
+
+	// Select a triangle.
+	tri := []Point{{X: 0, Y: 0}, {X: 50, Y: 0}, {X: 0, Y: 50}}
+	sel = m.SelectLasso(tri)
+	if len(sel) != 21 {
+		t.Fatalf("expected 21 points but saw %d: %v", len(sel), sel)
+	}
+	for _, s := range sel {
+		if s.X+s.Y > 5 {
+			t.Fatalf("unexpected point %v in selection", s)
+		}
+	}
+	if sel := m.SelectLasso(tri[:2]); sel != nil {
+		t.Fatalf("expected no selection from a degenerate lasso but saw %v", sel)
+	}
+
+	// Random lassos should agree with a brute-force search.
+	rng := rand.New(rand.NewSource(4600))
+	jm := jaggedMesh(rng, 20, 20, 400, 400, 0.4)
+	defer jm.Free()
+	pts := jm.Points()
+	for n := 0; n < 50; n++ {
+		poly := make([]Point, 3+rng.Intn(5))
+		for i := range poly {
+			poly[i] = Point{X: rng.Float64() * 400, Y: rng.Float64() * 400}
+		}
+		var want []image.Point
+		for r, row := range pts {
+			for c, p := range row {
+				if insidePolygon(p, poly) {
+					want = append(want, image.Point{X: c, Y: r})
+				}
+			}
+		}
+		if sel := jm.SelectLasso(poly); !reflect.DeepEqual(sel, want) {
+			t.Fatalf("expected %v but saw %v", want, sel)
+		}
+	}
+}
+
+// TestPickIndexInvalidation ensures that queries reflect changes made to a
+// mesh after a previous query.
+func TestPickIndexInvalidation(t *testing.T) {
+	m := NewRegularMesh(5, 5, 41, 41)
+	defer m.Free()
+	if c, r, _ := m.Nearest(Point{X: 12, Y: 12}); c != 1 || r != 1 {
+		t.Fatalf("expected (1, 1) but saw (%d, %d)", c, r)
+	}
+	m.Set(2, 2, Point{X: 13, Y: 13})
+	if c, r, _ := m.Nearest(Point{X: 12, Y: 12}); c != 2 || r != 2 {
+		t.Fatalf("expected (2, 2) but saw (%d, %d)", c, r)
+	}
+	if err := m.AddLine(0, 0.5, Vertical); err != nil {
+		t.Fatal(err)
+	}
+	if c, r, _ := m.Nearest(Point{X: 40, Y: 0}); c != 5 || r != 0 {
+		t.Fatalf("expected (5, 0) but saw (%d, %d)", c, r)
+	}
+}
@@ -0,0 +1,150 @@
+// This file provides functions for aligning meshes to each other using
+// Procrustes analysis.
+
+package xmorph
+
+import (
+	"fmt"
+	"image"
+	"math"
+)
+
+// AlignOptions control the Procrustes alignment performed by AlignTo and
+// AlignMeshes.
+type AlignOptions struct {
+	LabeledOnly bool // true = fit using only points with a nonzero label in every mesh
+	PinEdges    bool // true = leave points on the mesh's outer rows and columns unchanged
+}
+
+// alignmentIndexes returns the (column, row) indexes of the mesh points used
+// to fit an alignment.  ms must be compatible.
+func alignmentIndexes(ms []*Mesh, labeledOnly bool) []image.Point {
+	nx, ny := ms[0].NX, ms[0].NY
+	idx := make([]image.Point, 0, nx*ny)
+	for r := 0; r < ny; r++ {
+		for c := 0; c < nx; c++ {
+			use := true
+			if labeledOnly {
+				for _, m := range ms {
+					if m.GetLabel(c, r) == 0 {
+						use = false
+						break
+					}
+				}
+			}
+			if use {
+				idx = append(idx, image.Point{X: c, Y: r})
+			}
+		}
+	}
+	return idx
+}
+
+// selectPoints returns the points of a mesh at the given indexes.
+func selectPoints(m *Mesh, idx []image.Point) []Point {
+	pts := m.Points()
+	sel := make([]Point, len(idx))
+	for i, ix := range idx {
+		sel[i] = pts[ix.Y][ix.X]
+	}
+	return sel
+}
+
+// applyAll applies a transformation to each of a slice of points.
+func applyAll(t Transform, pts []Point) []Point {
+	out := make([]Point, len(pts))
+	for i, p := range pts {
+		out[i] = t.Apply(p)
+	}
+	return out
+}
+
+// AlignTo applies to m the similarity transformation (rotation, uniform
+// scaling, and translation) that best aligns it with a reference mesh in a
+// least-squares sense and returns the transformation used.  AlignTo returns
+// an error if the meshes are incompatible or if too few points are available
+// to fit a transformation.
+func (m *Mesh) AlignTo(ref *Mesh, opts AlignOptions) (Affine, error) {
+	ms := []*Mesh{m, ref}
+	if err := checkMeshesCompatible(ms, "AlignTo"); err != nil {
+		return Affine{}, err
+	}
+	idx := alignmentIndexes(ms, opts.LabeledOnly)
+	a, err := FitSimilarity(selectPoints(m, idx), selectPoints(ref, idx))
+	if err != nil {
+		return Affine{}, fmt.Errorf("failed to align meshes (%w)", err)
+	}
+	m.Transform(a, opts.PinEdges)
+	return a, nil
+}
+
+// AlignMeshes performs a generalized Procrustes alignment of a list of
+// compatible meshes.  It iteratively aligns every mesh to the mean of the
+// aligned meshes, which is itself kept in the coordinate system of the first
+// mesh, until the mean stops changing.  AlignMeshes applies the resulting
+// similarity transformations to the meshes and returns them, along with the
+// mean of the aligned meshes.
+func AlignMeshes(ms []*Mesh, opts AlignOptions) ([]Affine, *Mesh, error) {
+	if err := checkMeshesCompatible(ms, "AlignMeshes"); err != nil {
+		return nil, nil, err
+	}
+	idx := alignmentIndexes(ms, opts.LabeledOnly)
+	orig := make([][]Point, len(ms))
+	for i, m := range ms {
+		orig[i] = selectPoints(m, idx)
+	}
+
+	// Iteratively refine the reference shape.
+	ref := orig[0]
+	xfs := make([]Affine, len(ms))
+	_, _, size := normalizeShape(ref)
+	for iter := 0; iter < 100; iter++ {
+		// Align each mesh to the reference shape and average the
+		// results.
+		mean := make([]Point, len(ref))
+		for i, pts := range orig {
+			a, err := FitSimilarity(pts, ref)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to align meshes (%w)", err)
+			}
+			xfs[i] = a
+			for j, p := range applyAll(a, pts) {
+				mean[j] = mean[j].Add(p.Div(float64(len(ms))))
+			}
+		}
+
+		// Keep the mean in the first mesh's coordinate system so it
+		// cannot drift or shrink.
+		a, err := FitSimilarity(mean, orig[0])
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to align meshes (%w)", err)
+		}
+		mean = applyAll(a, mean)
+
+		// Stop when the reference shape stops changing.
+		change := 0.0
+		for j, p := range mean {
+			d := p.Sub(ref[j])
+			change += d.X*d.X + d.Y*d.Y
+		}
+		ref = mean
+		if math.Sqrt(change) <= 1e-10*size {
+			break
+		}
+	}
+
+	// Apply the final transformations to the meshes.
+	for i, m := range ms {
+		a, err := FitSimilarity(orig[i], ref)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to align meshes (%w)", err)
+		}
+		xfs[i] = a
+		m.Transform(a, opts.PinEdges)
+	}
+	mean, err := MeanMesh(ms)
+	if err != nil {
+		return nil, nil, err
+	}
+	return xfs, mean, nil
+}
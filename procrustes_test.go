@@ -0,0 +1,126 @@
+// The functions defined in this file ensure the xmorph package's Procrustes
+// alignment operations work as expected.
+
+package xmorph
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// TestAlignTo ensures that a mesh that differs from a reference mesh by a
+// similarity transformation can be aligned with it exactly.
+func TestAlignTo(t *testing.T) {
+	const nx, ny, wd, ht = 6, 5, 120, 100
+	rng := rand.New(rand.NewSource(40))
+	ref := jaggedMesh(rng, nx, ny, wd, ht, 0.3)
+	defer ref.Free()
+	m := MeshFromPoints(ref.Points())
+	defer m.Free()
+	xf := NewRotation(-0.4, Point{X: 60, Y: 50}).Then(NewScaling(1.3, 1.3, Point{})).Then(NewTranslation(20, -7))
+	m.Transform(xf, false)
+	a, err := m.AlignTo(ref, AlignOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d, err := MaxDisplacement(m, ref); err != nil || d > 1e-6 {
+		t.Fatalf("expected the aligned mesh to match the reference but saw a displacement of %v (%v)", d, err)
+	}
+	p := Point{X: 17, Y: 29}
+	if q := a.Apply(xf.Apply(p)); !q.Eq(p, 1e-6) {
+		t.Fatalf("expected the returned transformation to undo the original but %v mapped to %v", p, q)
+	}
+}
+
+// TestAlignToLabeled ensures that alignment can be restricted to labeled
+// points.
+func TestAlignToLabeled(t *testing.T) {
+	const nx, ny, wd, ht = 6, 5, 120, 100
+	ref := NewRegularMesh(nx, ny, wd, ht)
+	defer ref.Free()
+	m := MeshFromPoints(ref.Points())
+	defer m.Free()
+	xf := NewRotation(0.2, Point{}).Then(NewTranslation(5, 9))
+	m.Transform(xf, false)
+
+	// Corrupt every point except the labeled ones.
+	labeled := map[[2]int]bool{{1, 1}: true, {4, 2}: true, {2, 3}: true}
+	for r := 0; r < ny; r++ {
+		for c := 0; c < nx; c++ {
+			if labeled[[2]int{c, r}] {
+				m.SetLabel(c, r, 1)
+				ref.SetLabel(c, r, 1)
+				continue
+			}
+			m.Set(c, r, m.Get(c, r).Add(Point{X: 30, Y: -20}))
+		}
+	}
+	if _, err := m.AlignTo(ref, AlignOptions{LabeledOnly: true}); err != nil {
+		t.Fatal(err)
+	}
+	for cr := range labeled {
+		if p, q := m.Get(cr[0], cr[1]), ref.Get(cr[0], cr[1]); !p.Eq(q, 1e-6) {
+			t.Fatalf("expected labeled point %v to align with %v but saw %v", cr, q, p)
+		}
+	}
+
+	// Without enough labeled points, alignment should fail.
+	m.SetLabel(1, 1, 0)
+	m.SetLabel(4, 2, 0)
+	if _, err := m.AlignTo(ref, AlignOptions{LabeledOnly: true}); err == nil {
+		t.Fatal("expected alignment with a single labeled point to fail")
+	}
+}
+
+// TestAlignMeshes ensures that generalized Procrustes alignment brings
+// similar meshes into agreement in the first mesh's coordinate system and
+// leaves edges in place when asked.
+func TestAlignMeshes(t *testing.T) {
+	const nx, ny, wd, ht = 7, 6, 140, 120
+	rng := rand.New(rand.NewSource(400))
+	base := jaggedMesh(rng, nx, ny, wd, ht, 0.3)
+	defer base.Free()
+	ms := make([]*Mesh, 5)
+	for i := range ms {
+		ms[i] = MeshFromPoints(base.Points())
+		defer ms[i].Free()
+		if i > 0 {
+			c := Point{X: rng.Float64() * wd, Y: rng.Float64() * ht}
+			s := 0.7 + rng.Float64()*0.6
+			xf := NewRotation(rng.Float64()-0.5, c).Then(NewScaling(s, s, c)).Then(NewTranslation(rng.Float64()*20, rng.Float64()*20))
+			ms[i].Transform(xf, false)
+		}
+	}
+	xfs, mean, err := AlignMeshes(ms, AlignOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mean.Free()
+	if len(xfs) != len(ms) {
+		t.Fatalf("expected %d transformations but saw %d", len(ms), len(xfs))
+	}
+	for i, m := range ms {
+		if d, err := MaxDisplacement(m, base); err != nil || d > 1e-6 {
+			t.Fatalf("expected aligned mesh %d to match the first mesh but saw a displacement of %v (%v)", i, d, err)
+		}
+	}
+	if d, err := MaxDisplacement(mean, base); err != nil || d > 1e-6 {
+		t.Fatalf("expected the mean to match the first mesh but saw a displacement of %v (%v)", d, err)
+	}
+
+	// Pinned edges should not move.
+	m := MeshFromPoints(base.Points())
+	defer m.Free()
+	m.Transform(NewTranslation(10, 10), false)
+	e := MeshFromPoints(m.Points())
+	defer e.Free()
+	if _, _, err := AlignMeshes([]*Mesh{base, m}, AlignOptions{PinEdges: true}); err != nil {
+		t.Fatal(err)
+	}
+	if p, q := m.Get(0, 2), e.Get(0, 2); !p.Eq(q, 1e-9) {
+		t.Fatalf("expected edge point %v not to move but saw %v", q, p)
+	}
+	if p, q := m.Get(2, 2), base.Get(2, 2); !p.Eq(q, 1e-6) {
+		t.Fatalf("expected interior point to align with %v but saw %v", q, p)
+	}
+}
@@ -0,0 +1,201 @@
+// This file provides a function that adds rows and columns to a pair of
+// meshes where they are most needed.
+
+package xmorph
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+)
+
+// RefineOptions control the adaptive mesh refinement performed by
+// RefineMeshes.
+type RefineOptions struct {
+	MaxLines   int         // Maximum number of rows and columns to add
+	Image      image.Image // Source image whose edges attract new lines (may be nil)
+	EdgeWeight float64     // Weight of image-edge density relative to deformation (0.0 = ignore edges)
+	MinSpacing float64     // Minimum spacing in pixels between adjacent lines (0.0 = 4 pixels)
+}
+
+// lumaPlane converts an image to a slice of luminance values in [0.0, 1.0],
+// stored row by row, and returns it along with the image's width and height.
+func lumaPlane(img image.Image) ([]float64, int, int) {
+	bnds := img.Bounds()
+	wd, ht := bnds.Dx(), bnds.Dy()
+	pix := make([]float64, wd*ht)
+	for y := 0; y < ht; y++ {
+		for x := 0; x < wd; x++ {
+			g := color.Gray16Model.Convert(img.At(bnds.Min.X+x, bnds.Min.Y+y)).(color.Gray16)
+			pix[y*wd+x] = float64(g.Y) / 65535.0
+		}
+	}
+	return pix, wd, ht
+}
+
+// sobelMagnitude returns the gradient magnitude of a luminance plane, as
+// computed by the Sobel operator, normalized so that a step from black to
+// white has magnitude 1.0.  Pixels beyond the image's edges replicate the
+// nearest edge pixel.
+func sobelMagnitude(pix []float64, wd, ht int) []float64 {
+	at := func(x, y int) float64 {
+		return pix[clampInt(y, 0, ht-1)*wd+clampInt(x, 0, wd-1)]
+	}
+	mag := make([]float64, wd*ht)
+	for y := 0; y < ht; y++ {
+		for x := 0; x < wd; x++ {
+			gx := (at(x+1, y-1) + 2*at(x+1, y) + at(x+1, y+1)) -
+				(at(x-1, y-1) + 2*at(x-1, y) + at(x-1, y+1))
+			gy := (at(x-1, y+1) + 2*at(x, y+1) + at(x+1, y+1)) -
+				(at(x-1, y-1) + 2*at(x, y-1) + at(x+1, y-1))
+			mag[y*wd+x] = math.Hypot(gx, gy) / 4.0
+		}
+	}
+	return mag
+}
+
+// A summedArea is a summed-area table, which sums the values in any
+// rectangle in constant time.
+type summedArea struct {
+	wd, ht int       // Dimensions of the original data
+	sum    []float64 // (wd+1)×(ht+1) table of prefix sums
+}
+
+// newSummedArea constructs a summed-area table from a wd×ht plane of values.
+func newSummedArea(v []float64, wd, ht int) *summedArea {
+	sa := &summedArea{wd: wd, ht: ht, sum: make([]float64, (wd+1)*(ht+1))}
+	for y := 0; y < ht; y++ {
+		row := 0.0
+		for x := 0; x < wd; x++ {
+			row += v[y*wd+x]
+			sa.sum[(y+1)*(wd+1)+x+1] = sa.sum[y*(wd+1)+x+1] + row
+		}
+	}
+	return sa
+}
+
+// mean returns the mean value within a rectangle, clipped to the data's
+// bounds.  It returns 0 for an empty rectangle.
+func (sa *summedArea) mean(r image.Rectangle) float64 {
+	r = r.Intersect(image.Rect(0, 0, sa.wd, sa.ht))
+	if r.Empty() {
+		return 0.0
+	}
+	w := sa.wd + 1
+	s := sa.sum[r.Max.Y*w+r.Max.X] - sa.sum[r.Min.Y*w+r.Max.X] -
+		sa.sum[r.Max.Y*w+r.Min.X] + sa.sum[r.Min.Y*w+r.Min.X]
+	return s / float64(r.Dx()*r.Dy())
+}
+
+// gapScores scores each gap between adjacent columns of a pair of meshes,
+// given as 2-D slices of points, by the largest change in displacement
+// across the gap plus, if edges is non-nil, edgeWeight times the gap's mean
+// width times the mean edge strength in the strip of the image the gap
+// covers.  Gaps narrower than twice minSpacing in either mesh receive a
+// score of -1.  Rows can be scored by transposing the inputs.
+func gapScores(src, dst [][]Point, edges *summedArea, edgeWeight, minSpacing float64, transposed bool) []float64 {
+	nx := len(src[0])
+	scores := make([]float64, nx-1)
+	for c := range scores {
+		narrow := math.Inf(1)
+		width, deform := 0.0, 0.0
+		lo, hi := math.Inf(1), math.Inf(-1)
+		for r := range src {
+			narrow = math.Min(narrow, src[r][c+1].X-src[r][c].X)
+			narrow = math.Min(narrow, dst[r][c+1].X-dst[r][c].X)
+			width += src[r][c+1].X - src[r][c].X
+			d0 := dst[r][c].Sub(src[r][c])
+			d1 := dst[r][c+1].Sub(src[r][c+1])
+			deform = math.Max(deform, math.Hypot(d1.X-d0.X, d1.Y-d0.Y))
+			lo = math.Min(lo, src[r][c].X)
+			hi = math.Max(hi, src[r][c+1].X)
+		}
+		if narrow < 2*minSpacing {
+			scores[c] = -1.0
+			continue
+		}
+		scores[c] = deform
+		if edges != nil {
+			strip := image.Rect(int(math.Floor(lo)), 0, int(math.Ceil(hi))+1, edges.ht)
+			if transposed {
+				strip = image.Rect(0, int(math.Floor(lo)), edges.wd, int(math.Ceil(hi))+1)
+			}
+			width /= float64(len(src))
+			scores[c] += edgeWeight * width * edges.mean(strip)
+		}
+	}
+	return scores
+}
+
+// RefineMeshes returns copies of a pair of compatible source and destination
+// meshes to which up to opts.MaxLines rows and columns have been added with
+// AddLine.  Each line is added halfway across the gap between adjacent rows
+// or columns with the highest score, where a gap's score is the largest
+// difference in displacement (from source to destination) across it plus,
+// if opts.Image is provided, opts.EdgeWeight times the density of image edges
+// in the region of the source image that it covers.  Gaps that would leave
+// lines closer than opts.MinSpacing pixels apart in either mesh are never
+// split.  Refinement stops early if no gap has a positive score.  The
+// returned meshes remain compatible with each other, and because new points
+// lie on the existing mesh lines, the warp they define is essentially
+// unchanged; the added points simply provide finer control where it is most
+// likely to be needed.
+func RefineMeshes(src, dst *Mesh, opts RefineOptions) (*Mesh, *Mesh, error) {
+	// Check the arguments.
+	if err := checkMeshesCompatible([]*Mesh{src, dst}, "RefineMeshes"); err != nil {
+		return nil, nil, err
+	}
+	switch {
+	case opts.MaxLines < 0:
+		return nil, nil, fmt.Errorf("line count must be non-negative (saw %d)", opts.MaxLines)
+	case opts.EdgeWeight < 0.0:
+		return nil, nil, fmt.Errorf("edge weight must be non-negative (saw %.5g)", opts.EdgeWeight)
+	case opts.EdgeWeight > 0.0 && opts.Image == nil:
+		return nil, nil, fmt.Errorf("an image is required when the edge weight is nonzero")
+	case opts.MinSpacing < 0.0:
+		return nil, nil, fmt.Errorf("minimum spacing must be non-negative (saw %.5g)", opts.MinSpacing)
+	}
+	minSpacing := opts.MinSpacing
+	if minSpacing == 0.0 {
+		minSpacing = 4.0
+	}
+
+	// Measure edge strength across the source image.
+	var edges *summedArea
+	if opts.EdgeWeight > 0.0 {
+		pix, wd, ht := lumaPlane(opts.Image)
+		edges = newSummedArea(sobelMagnitude(pix, wd, ht), wd, ht)
+	}
+
+	// Repeatedly split the highest-scoring gap.
+	rs, rd := src.Copy(), dst.Copy()
+	for n := 0; n < opts.MaxLines; n++ {
+		sPts, dPts := rs.Points(), rd.Points()
+		best, bestDir, bestScore := -1, Vertical, 0.0
+		for i, s := range gapScores(sPts, dPts, edges, opts.EdgeWeight, minSpacing, false) {
+			if s > bestScore {
+				best, bestDir, bestScore = i, Vertical, s
+			}
+		}
+		lbls := rs.meshLabels()
+		sPts, _ = transposeGrid(sPts, lbls)
+		dPts, _ = transposeGrid(dPts, lbls)
+		for i, s := range gapScores(sPts, dPts, edges, opts.EdgeWeight, minSpacing, true) {
+			if s > bestScore {
+				best, bestDir, bestScore = i, Horizontal, s
+			}
+		}
+		if best == -1 {
+			break
+		}
+		for _, m := range []*Mesh{rs, rd} {
+			if err := m.AddLine(best, 0.5, bestDir); err != nil {
+				rs.Free()
+				rd.Free()
+				return nil, nil, err
+			}
+		}
+	}
+	return rs, rd, nil
+}
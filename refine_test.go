@@ -0,0 +1,114 @@
+// The functions defined in this file ensure the xmorph package's adaptive
+// mesh refinement works as expected.
+
+package xmorph
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// TestRefineMeshesDeformation ensures that lines are added next to the
+// region of largest deformation.
+func TestRefineMeshesDeformation(t *testing.T) {
+	src := NewRegularMesh(5, 5, 101, 101)
+	defer src.Free()
+	dst := NewRegularMesh(5, 5, 101, 101)
+	defer dst.Free()
+	dst.Set(1, 1, Point{X: 35, Y: 30})
+	rs, rd, err := RefineMeshes(src, dst, RefineOptions{MaxLines: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Free()
+	defer rd.Free()
+	if rs.NX != 7 || rs.NY != 7 || rd.NX != 7 || rd.NY != 7 {
+		t.Fatalf("expected 7x7 meshes but saw %dx%d and %dx%d", rs.NX, rs.NY, rd.NX, rd.NY)
+	}
+	mid, err := InterpolateMeshes(rs, rd, 0.5)
+	if err != nil {
+		t.Fatalf("expected compatible meshes (%v)", err)
+	}
+	mid.Free()
+
+	// Lines should split the gaps on either side of the displaced point,
+	// first the columns and then the rows.
+	for i, v := range []float64{0, 12.5, 25, 37.5, 50, 75, 100} {
+		if p := rs.Get(i, i); !p.Eq(Point{X: v, Y: v}, 1e-9) {
+			t.Fatalf("expected (%v, %v) but saw %v", v, v, p)
+		}
+	}
+	if p := rd.Get(2, 2); !p.Eq(Point{X: 35, Y: 30}, 1e-9) {
+		t.Fatalf("expected the displaced point at (35, 30) but saw %v", p)
+	}
+
+	// Identical meshes need no refinement.
+	rs2, rd2, err := RefineMeshes(src, src, RefineOptions{MaxLines: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs2.Free()
+	defer rd2.Free()
+	if rs2.NX != 5 || rs2.NY != 5 {
+		t.Fatalf("expected an unrefined 5x5 mesh but saw %dx%d", rs2.NX, rs2.NY)
+	}
+
+	// Lines are never added closer than the minimum spacing.
+	rs3, rd3, err := RefineMeshes(src, dst, RefineOptions{MaxLines: 100, MinSpacing: 6})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs3.Free()
+	defer rd3.Free()
+	for _, m := range []*Mesh{rs3, rd3} {
+		for r := 0; r < m.NY; r++ {
+			for c := 0; c+1 < m.NX; c++ {
+				if dx := m.Get(c+1, r).X - m.Get(c, r).X; dx < 6 {
+					t.Fatalf("expected a spacing of at least 6 but saw %v at (%d, %d)", dx, c, r)
+				}
+			}
+		}
+	}
+}
+
+// TestRefineMeshesEdges ensures that lines are attracted to image edges.
+func TestRefineMeshesEdges(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 101, 101))
+	for y := 0; y < 101; y++ {
+		for x := 80; x < 101; x++ {
+			img.SetGray(x, y, color.Gray{Y: 255})
+		}
+	}
+	m := NewRegularMesh(5, 5, 101, 101)
+	defer m.Free()
+	rs, rd, err := RefineMeshes(m, m, RefineOptions{MaxLines: 1, Image: img, EdgeWeight: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Free()
+	defer rd.Free()
+	if rs.NX != 6 || rs.NY != 5 {
+		t.Fatalf("expected a 6x5 mesh but saw %dx%d", rs.NX, rs.NY)
+	}
+	if p := rs.Get(4, 0); !p.Eq(Point{X: 87.5, Y: 0}, 1e-9) {
+		t.Fatalf("expected a new column at x = 87.5 but saw %v", p)
+	}
+
+	// Invalid options should be rejected.
+	for _, opts := range []RefineOptions{
+		{MaxLines: -1},
+		{MaxLines: 1, EdgeWeight: 1},
+		{MaxLines: 1, EdgeWeight: -1, Image: img},
+		{MaxLines: 1, MinSpacing: -1},
+	} {
+		if _, _, err := RefineMeshes(m, m, opts); err == nil {
+			t.Fatalf("expected options %+v to be rejected", opts)
+		}
+	}
+	small := NewRegularMesh(4, 4, 101, 101)
+	defer small.Free()
+	if _, _, err := RefineMeshes(m, small, RefineOptions{MaxLines: 1}); err == nil {
+		t.Fatal("expected incompatible meshes to be rejected")
+	}
+}
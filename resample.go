@@ -0,0 +1,80 @@
+// This file provides a function for changing a mesh's dimensions.
+
+package xmorph
+
+import "fmt"
+
+// resamplePoints evaluates a smooth surface through a 2-D slice of mesh points
+// at nx×ny evenly spaced parameter positions.  The surface is a tensor product
+// of the monotonicity-preserving splines used elsewhere in the package,
+// parameterized by column and row index.
+func resamplePoints(pts [][]Point, nx, ny int) [][]Point {
+	oldNy, oldNx := len(pts), len(pts[0])
+	param := func(old, n int) []float64 {
+		ps := make([]float64, n)
+		for i := range ps {
+			ps[i] = float64(i*(old-1)) / float64(n-1)
+		}
+		return ps
+	}
+	index := func(n int) []float64 {
+		idx := make([]float64, n)
+		for i := range idx {
+			idx[i] = float64(i)
+		}
+		return idx
+	}
+
+	// Resample each row horizontally.
+	us := param(oldNx, nx)
+	uKnots := index(oldNx)
+	tmp := make([][]Point, oldNy)
+	for r, row := range pts {
+		xs := make([]float64, oldNx)
+		ys := make([]float64, oldNx)
+		for c, pt := range row {
+			xs[c], ys[c] = pt.X, pt.Y
+		}
+		sx := newHermiteSpline(uKnots, xs)
+		sy := newHermiteSpline(uKnots, ys)
+		tmp[r] = make([]Point, nx)
+		for c, u := range us {
+			tmp[r][c] = Point{X: sx.eval(u), Y: sy.eval(u)}
+		}
+	}
+
+	// Resample each resulting column vertically.
+	vs := param(oldNy, ny)
+	vKnots := index(oldNy)
+	out := make([][]Point, ny)
+	for r := range out {
+		out[r] = make([]Point, nx)
+	}
+	for c := 0; c < nx; c++ {
+		xs := make([]float64, oldNy)
+		ys := make([]float64, oldNy)
+		for r := range tmp {
+			xs[r], ys[r] = tmp[r][c].X, tmp[r][c].Y
+		}
+		sx := newHermiteSpline(vKnots, xs)
+		sy := newHermiteSpline(vKnots, ys)
+		for r, v := range vs {
+			out[r][c] = Point{X: sx.eval(v), Y: sy.eval(v)}
+		}
+	}
+	return out
+}
+
+// Resample returns a new nx×ny mesh that describes the same shape as m.  The
+// new mesh's points are obtained by evaluating a smooth surface through m's
+// points at evenly spaced positions in m's row/column index space.  Hence,
+// resampling a source and a destination mesh to the same dimensions produces
+// compatible meshes that describe essentially the same warp.  Corner points
+// are preserved exactly, and edges that lie along the image boundary remain
+// there.  Labels are not preserved.
+func (m *Mesh) Resample(nx, ny int) (*Mesh, error) {
+	if nx < 4 || ny < 4 {
+		return nil, fmt.Errorf("mesh must be at least 4x4 (requested %dx%d)", nx, ny)
+	}
+	return MeshFromPoints(resamplePoints(m.Points(), nx, ny)), nil
+}
@@ -0,0 +1,83 @@
+// The functions defined in this file ensure the xmorph package's resampling
+// operations work as expected.
+
+package xmorph
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// TestResampleRegular ensures that resampling a regular mesh produces a
+// regular mesh.
+func TestResampleRegular(t *testing.T) {
+	const wd, ht = 321, 241
+	m := NewRegularMesh(5, 7, wd, ht)
+	defer m.Free()
+	sizes := [][2]int{{5, 7}, {9, 13}, {4, 4}, {17, 6}}
+	for _, sz := range sizes {
+		mr, err := m.Resample(sz[0], sz[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		validateMeshDimens(t, mr, sz[0], sz[1])
+		reg := NewRegularMesh(sz[0], sz[1], wd, ht)
+		for r := 0; r < sz[1]; r++ {
+			for c := 0; c < sz[0]; c++ {
+				if p, q := mr.Get(c, r), reg.Get(c, r); !p.Eq(q, 1e-9) {
+					t.Fatalf("%dx%d: expected (%d, %d) = %v but saw %v", sz[0], sz[1], c, r, q, p)
+				}
+			}
+		}
+		mr.Free()
+		reg.Free()
+	}
+	if _, err := m.Resample(3, 10); err == nil {
+		t.Fatal("expected resampling to 3x10 to fail")
+	}
+}
+
+// TestResampleRefine ensures that resampling a mesh to (2n-1)×(2m-1) retains
+// the original points and keeps the edges on the image boundary.
+func TestResampleRefine(t *testing.T) {
+	const nx, ny, wd, ht = 6, 5, 200, 150
+	m := NewRegularMesh(nx, ny, wd, ht)
+	defer m.Free()
+	rng := rand.New(rand.NewSource(32))
+	for r := 1; r < ny-1; r++ {
+		for c := 1; c < nx-1; c++ {
+			pt := m.Get(c, r)
+			pt.X += rng.Float64()*10 - 5
+			pt.Y += rng.Float64()*10 - 5
+			m.Set(c, r, pt)
+		}
+	}
+	mr, err := m.Resample(2*nx-1, 2*ny-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Free()
+	for r := 0; r < ny; r++ {
+		for c := 0; c < nx; c++ {
+			if p, q := m.Get(c, r), mr.Get(2*c, 2*r); !p.Eq(q, 1e-9) {
+				t.Fatalf("expected (%d, %d) = %v but saw %v", 2*c, 2*r, p, q)
+			}
+		}
+	}
+	for r := 0; r < mr.NY; r++ {
+		if x := mr.Get(0, r).X; x != 0 {
+			t.Fatalf("left edge moved to x = %v in row %d", x, r)
+		}
+		if x := mr.Get(mr.NX-1, r).X; x != wd-1 {
+			t.Fatalf("right edge moved to x = %v in row %d", x, r)
+		}
+	}
+	for c := 0; c < mr.NX; c++ {
+		if y := mr.Get(c, 0).Y; y != 0 {
+			t.Fatalf("top edge moved to y = %v in column %d", y, c)
+		}
+		if y := mr.Get(c, mr.NY-1).Y; y != ht-1 {
+			t.Fatalf("bottom edge moved to y = %v in column %d", y, c)
+		}
+	}
+}
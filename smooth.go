@@ -0,0 +1,255 @@
+// This file provides functions for smoothing and relaxing meshes.
+
+package xmorph
+
+import (
+	"fmt"
+	"math"
+)
+
+// SmoothOptions control the mesh-smoothing methods SmoothLaplacian,
+// SmoothTaubin, and Relax.  Points on the mesh's edges never move so they
+// remain on the image boundary.
+type SmoothOptions struct {
+	Iterations int      // Number of smoothing passes (or maximum number for Relax)
+	Strength   float64  // Smoothing strength in (0.0, 1.0]
+	Mu         float64  // Taubin's negative inflation factor (0.0 = -1.04·Strength)
+	Pinned     [][]bool // Points, indexed [row][column], that must not move (may be nil)
+	PinLabeled bool     // true = also pin points with a nonzero label
+}
+
+// validate checks a set of SmoothOptions for errors.
+func (opts *SmoothOptions) validate(m *Mesh) error {
+	if opts.Iterations < 0 {
+		return fmt.Errorf("smoothing iteration count must be non-negative (saw %d)", opts.Iterations)
+	}
+	if opts.Strength <= 0.0 || opts.Strength > 1.0 {
+		return fmt.Errorf("smoothing strength %.5g does not lie in the range (0.0, 1.0]", opts.Strength)
+	}
+	if opts.Pinned != nil {
+		if len(opts.Pinned) != m.NY {
+			return fmt.Errorf("pinned-point slice has %d rows but the mesh has %d", len(opts.Pinned), m.NY)
+		}
+		for r, row := range opts.Pinned {
+			if len(row) != m.NX {
+				return fmt.Errorf("pinned-point slice row %d has %d columns but the mesh has %d", r, len(row), m.NX)
+			}
+		}
+	}
+	return nil
+}
+
+// movable returns a 2-D slice indicating which mesh points may move.
+func (opts *SmoothOptions) movable(m *Mesh) [][]bool {
+	mv := make([][]bool, m.NY)
+	for r := range mv {
+		mv[r] = make([]bool, m.NX)
+		if r == 0 || r == m.NY-1 {
+			continue
+		}
+		for c := 1; c < m.NX-1; c++ {
+			switch {
+			case opts.Pinned != nil && opts.Pinned[r][c]:
+			case opts.PinLabeled && m.GetLabel(c, r) != 0:
+			default:
+				mv[r][c] = true
+			}
+		}
+	}
+
+	// In symmetric-editing mode, pinning a point also pins its partner.
+	if m.sym != nil {
+		for r, row := range mv {
+			for c := range row {
+				if pc, pr := m.mirrorPartner(c, r); !mv[pr][pc] {
+					mv[r][c] = false
+				}
+			}
+		}
+	}
+	return mv
+}
+
+// cellGood reports whether a quadrilateral whose vertices are listed in
+// clockwise screen order is convex and properly oriented.
+func cellGood(q [4]Point) bool {
+	if cellArea(q) <= 0.0 {
+		return false
+	}
+	for i := range q {
+		if cross(q[i], q[(i+1)%4], q[(i+2)%4]) <= 0.0 {
+			return false
+		}
+	}
+	return true
+}
+
+// localConstraints evaluates the constraints that a valid mesh must satisfy
+// in the vicinity of interior point (c, r): each of the four cells sharing the
+// point must be convex and properly oriented, and the point must lie strictly
+// between its horizontal and vertical neighbors.
+func localConstraints(pts [][]Point, r, c int) [8]bool {
+	var ok [8]bool
+	i := 0
+	for _, d := range [][2]int{{-1, -1}, {-1, 0}, {0, -1}, {0, 0}} {
+		r0, c0 := r+d[0], c+d[1]
+		ok[i] = cellGood([4]Point{pts[r0][c0], pts[r0][c0+1], pts[r0+1][c0+1], pts[r0+1][c0]})
+		i++
+	}
+	p := pts[r][c]
+	ok[4] = p.X > pts[r][c-1].X
+	ok[5] = p.X < pts[r][c+1].X
+	ok[6] = p.Y > pts[r-1][c].Y
+	ok[7] = p.Y < pts[r+1][c].Y
+	return ok
+}
+
+// tryMove moves interior point (c, r) to a new location unless doing so would
+// violate a local constraint that currently holds.  It reports whether the
+// point was moved.
+func tryMove(pts [][]Point, r, c int, p Point) bool {
+	before := localConstraints(pts, r, c)
+	old := pts[r][c]
+	pts[r][c] = p
+	after := localConstraints(pts, r, c)
+	for i := range before {
+		if before[i] && !after[i] {
+			pts[r][c] = old
+			return false
+		}
+	}
+	return true
+}
+
+// neighborAverage returns the average of the four neighbors of interior point
+// (c, r).
+func neighborAverage(pts [][]Point, r, c int) Point {
+	return pts[r-1][c].Add(pts[r+1][c]).Add(pts[r][c-1]).Add(pts[r][c+1]).Div(4.0)
+}
+
+// laplacianPass moves each movable point a fraction f of the way towards the
+// average of its neighbors.  Targets are computed from the positions at the
+// start of the pass.  Moves that would introduce a fold-over are skipped.
+func laplacianPass(pts [][]Point, mv [][]bool, f float64) {
+	ny, nx := len(pts), len(pts[0])
+	targets := make([][]Point, ny)
+	for r := 1; r < ny-1; r++ {
+		targets[r] = make([]Point, nx)
+		for c := 1; c < nx-1; c++ {
+			if mv[r][c] {
+				p := pts[r][c]
+				targets[r][c] = p.Add(neighborAverage(pts, r, c).Sub(p).Mul(f))
+			}
+		}
+	}
+	for r := 1; r < ny-1; r++ {
+		for c := 1; c < nx-1; c++ {
+			if mv[r][c] {
+				tryMove(pts, r, c, targets[r][c])
+			}
+		}
+	}
+}
+
+// storeMovable writes all movable points back to the mesh.  In
+// symmetric-editing mode, it first symmetrizes the points, skipping any pair
+// whose symmetrization would introduce a fold-over.
+func (m *Mesh) storeMovable(pts [][]Point, mv [][]bool) {
+	if m.sym != nil {
+		m.symmetrize(pts, mv, func(r, c int, p Point) bool { return tryMove(pts, r, c, p) })
+	}
+	m.BeginTransaction()
+	defer m.EndTransaction()
+	for r, row := range pts {
+		for c, pt := range row {
+			if mv[r][c] {
+				m.setRecorded(c, r, pt)
+			}
+		}
+	}
+}
+
+// SmoothLaplacian smooths a mesh by repeatedly moving each unpinned interior
+// point Strength of the way towards the average of its four neighbors.
+// Laplacian smoothing is simple and effective but gradually shrinks features.
+// Moves that would fold or invert a cell or reorder a point relative to its
+// neighbors are skipped, so smoothing never introduces fold-overs.
+func (m *Mesh) SmoothLaplacian(opts SmoothOptions) error {
+	if err := opts.validate(m); err != nil {
+		return err
+	}
+	pts := m.Points()
+	mv := opts.movable(m)
+	for i := 0; i < opts.Iterations; i++ {
+		laplacianPass(pts, mv, opts.Strength)
+	}
+	m.storeMovable(pts, mv)
+	return nil
+}
+
+// SmoothTaubin smooths a mesh using Taubin's λ|μ algorithm, which alternates a
+// Laplacian pass of strength λ = Strength with an inflating pass of strength
+// μ = Mu < -λ.  This removes jaggedness without the shrinkage of plain
+// Laplacian smoothing.  Like SmoothLaplacian, SmoothTaubin never introduces
+// fold-overs.
+func (m *Mesh) SmoothTaubin(opts SmoothOptions) error {
+	if err := opts.validate(m); err != nil {
+		return err
+	}
+	mu := opts.Mu
+	if mu == 0.0 {
+		mu = -1.04 * opts.Strength
+	}
+	if mu >= -opts.Strength {
+		return fmt.Errorf("Taubin factor mu = %.5g must be less than -Strength = %.5g", mu, -opts.Strength)
+	}
+	pts := m.Points()
+	mv := opts.movable(m)
+	for i := 0; i < opts.Iterations; i++ {
+		laplacianPass(pts, mv, opts.Strength)
+		laplacianPass(pts, mv, mu)
+	}
+	m.storeMovable(pts, mv)
+	return nil
+}
+
+// Relax moves a mesh's unpinned interior points to minimize the energy
+//
+//	E = s·Σ|p_i − p_j|² + (1 − s)·Σ deg(i)·|p_i − p⁰_i|²
+//
+// where the first sum runs over all pairs of adjacent points, the second sum
+// runs over all points, s is Strength, deg(i) is the number of neighbors of
+// point i, and p⁰_i is point i's initial position.  That is, Relax balances
+// evenness of the mesh against fidelity to the original.  A Strength of 1.0
+// ignores the original positions entirely.  Relaxation stops after Iterations
+// Gauss–Seidel sweeps or once no point moves by more than 0.001 pixels.  Like
+// the other smoothing methods, Relax never introduces fold-overs.
+func (m *Mesh) Relax(opts SmoothOptions) error {
+	if err := opts.validate(m); err != nil {
+		return err
+	}
+	orig := m.Points()
+	pts := m.Points()
+	mv := opts.movable(m)
+	s := opts.Strength
+	for i := 0; i < opts.Iterations; i++ {
+		maxDelta := 0.0
+		for r := 1; r < m.NY-1; r++ {
+			for c := 1; c < m.NX-1; c++ {
+				if !mv[r][c] {
+					continue
+				}
+				p := pts[r][c]
+				q := neighborAverage(pts, r, c).Mul(s).Add(orig[r][c].Mul(1.0 - s))
+				if tryMove(pts, r, c, q) {
+					maxDelta = math.Max(maxDelta, math.Hypot(q.X-p.X, q.Y-p.Y))
+				}
+			}
+		}
+		if maxDelta <= 0.001 {
+			break
+		}
+	}
+	m.storeMovable(pts, mv)
+	return nil
+}
@@ -0,0 +1,147 @@
+// The functions defined in this file ensure the xmorph package's smoothing
+// operations work as expected.
+
+package xmorph
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// jaggedMesh returns a regular mesh with randomly perturbed interior points,
+// like the one used in ExampleWarp.
+func jaggedMesh(rng *rand.Rand, nx, ny, wd, ht int, amt float64) *Mesh {
+	m := NewRegularMesh(nx, ny, wd, ht)
+	dx := float64(wd) / float64(nx) * amt
+	dy := float64(ht) / float64(ny) * amt
+	for r := 1; r < ny-1; r++ {
+		for c := 1; c < nx-1; c++ {
+			pt := m.Get(c, r)
+			pt.X += rng.Float64()*dx*2.0 - dx
+			pt.Y += rng.Float64()*dy*2.0 - dy
+			m.Set(c, r, pt)
+		}
+	}
+	return m
+}
+
+// roughness returns the sum of the distances of each interior mesh point from
+// the average of its neighbors.
+func roughness(m *Mesh) float64 {
+	pts := m.Points()
+	sum := 0.0
+	for r := 1; r < m.NY-1; r++ {
+		for c := 1; c < m.NX-1; c++ {
+			d := pts[r][c].Sub(neighborAverage(pts, r, c))
+			sum += math.Hypot(d.X, d.Y)
+		}
+	}
+	return sum
+}
+
+// badCells returns the number of inverted or folded cells in a mesh.
+func badCells(m *Mesh, wd, ht int) int {
+	rep := m.Validate(wd, ht)
+	return len(rep.InvertedCells) + len(rep.FoldedCells)
+}
+
+// TestSmoothReducesRoughness ensures that each smoothing method makes a
+// jagged mesh smoother without introducing fold-overs.
+func TestSmoothReducesRoughness(t *testing.T) {
+	const nx, ny, wd, ht = 12, 10, 240, 200
+	methods := map[string]func(*Mesh, SmoothOptions) error{
+		"Laplacian": (*Mesh).SmoothLaplacian,
+		"Taubin":    (*Mesh).SmoothTaubin,
+		"Relax":     (*Mesh).Relax,
+	}
+	for name, smooth := range methods {
+		for _, amt := range []float64{0.3, 0.9} {
+			rng := rand.New(rand.NewSource(34))
+			m := jaggedMesh(rng, nx, ny, wd, ht, amt)
+			before, bad := roughness(m), badCells(m, wd, ht)
+			err := smooth(m, SmoothOptions{Iterations: 10, Strength: 0.5})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if after := roughness(m); after >= before {
+				t.Fatalf("%s: roughness increased from %.5g to %.5g", name, before, after)
+			}
+			if nBad := badCells(m, wd, ht); nBad > bad {
+				t.Fatalf("%s: bad cells increased from %d to %d", name, bad, nBad)
+			}
+			m.Free()
+		}
+	}
+}
+
+// TestSmoothPinned ensures that pinned and labeled points do not move.
+func TestSmoothPinned(t *testing.T) {
+	const nx, ny, wd, ht = 8, 8, 160, 160
+	rng := rand.New(rand.NewSource(35))
+	m := jaggedMesh(rng, nx, ny, wd, ht, 0.4)
+	defer m.Free()
+	pinned := make([][]bool, ny)
+	for r := range pinned {
+		pinned[r] = make([]bool, nx)
+	}
+	pinned[3][4] = true
+	m.SetLabel(2, 5, 1)
+	p1, p2 := m.Get(4, 3), m.Get(2, 5)
+	err := m.SmoothLaplacian(SmoothOptions{
+		Iterations: 20,
+		Strength:   0.7,
+		Pinned:     pinned,
+		PinLabeled: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q := m.Get(4, 3); q != p1 {
+		t.Fatalf("pinned point moved from %v to %v", p1, q)
+	}
+	if q := m.Get(2, 5); q != p2 {
+		t.Fatalf("labeled point moved from %v to %v", p2, q)
+	}
+}
+
+// TestRelaxRegular ensures that fully relaxing a jagged mesh produces a
+// regular mesh.
+func TestRelaxRegular(t *testing.T) {
+	const nx, ny, wd, ht = 9, 7, 161, 121
+	rng := rand.New(rand.NewSource(36))
+	m := jaggedMesh(rng, nx, ny, wd, ht, 0.4)
+	defer m.Free()
+	if err := m.Relax(SmoothOptions{Iterations: 1000, Strength: 1.0}); err != nil {
+		t.Fatal(err)
+	}
+	reg := NewRegularMesh(nx, ny, wd, ht)
+	defer reg.Free()
+	for r := 0; r < ny; r++ {
+		for c := 0; c < nx; c++ {
+			if p, q := m.Get(c, r), reg.Get(c, r); !p.Eq(q, 0.05) {
+				t.Fatalf("expected (%d, %d) = %v but saw %v", c, r, q, p)
+			}
+		}
+	}
+}
+
+// TestSmoothOptionErrors ensures that invalid options are rejected.
+func TestSmoothOptionErrors(t *testing.T) {
+	m := NewRegularMesh(5, 5, 50, 50)
+	defer m.Free()
+	bad := []SmoothOptions{
+		{Iterations: -1, Strength: 0.5},
+		{Iterations: 1, Strength: 0.0},
+		{Iterations: 1, Strength: 1.5},
+		{Iterations: 1, Strength: 0.5, Pinned: make([][]bool, 4)},
+	}
+	for _, opts := range bad {
+		if err := m.SmoothLaplacian(opts); err == nil {
+			t.Fatalf("expected options %+v to be rejected", opts)
+		}
+	}
+	if err := m.SmoothTaubin(SmoothOptions{Iterations: 1, Strength: 0.5, Mu: -0.4}); err == nil {
+		t.Fatal("expected a Taubin mu > -lambda to be rejected")
+	}
+}
@@ -0,0 +1,186 @@
+// This file provides a pure-Go implementation of the piecewise cubic Hermite
+// splines with which libmorph interpolates between mesh points.
+
+package xmorph
+
+import (
+	"math"
+	"sort"
+)
+
+// A hermiteSpline is a piecewise cubic Hermite interpolant y = f(x) through a
+// set of knots.  Knot derivatives are chosen to preserve monotonicity so that
+// a functional mesh produces a functional (non-folding) interpolant.
+type hermiteSpline struct {
+	kx []float64 // Knot x coordinates, strictly increasing
+	ky []float64 // Knot y coordinates
+	d  []float64 // Derivative dy/dx at each knot
+}
+
+// newHermiteSpline constructs a hermiteSpline through the knots (kx[i],
+// ky[i]).  Knots are sorted by x, and knots that repeat an earlier x
+// coordinate are discarded.
+func newHermiteSpline(kx, ky []float64) *hermiteSpline {
+	// Sort the knots by x coordinate and discard duplicates.
+	idx := make([]int, len(kx))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(a, b int) bool { return kx[idx[a]] < kx[idx[b]] })
+	s := &hermiteSpline{
+		kx: make([]float64, 0, len(kx)),
+		ky: make([]float64, 0, len(ky)),
+	}
+	for _, i := range idx {
+		n := len(s.kx)
+		if n > 0 && kx[i] <= s.kx[n-1] {
+			continue
+		}
+		s.kx = append(s.kx, kx[i])
+		s.ky = append(s.ky, ky[i])
+	}
+
+	// Compute the slope of each interval.
+	n := len(s.kx)
+	s.d = make([]float64, n)
+	if n < 2 {
+		return s
+	}
+	h := make([]float64, n-1)
+	m := make([]float64, n-1)
+	for i := range h {
+		h[i] = s.kx[i+1] - s.kx[i]
+		m[i] = (s.ky[i+1] - s.ky[i]) / h[i]
+	}
+	if n == 2 {
+		s.d[0], s.d[1] = m[0], m[0]
+		return s
+	}
+
+	// Assign interior derivatives using the Fritsch-Butland weighted
+	// harmonic mean, which is zero at local extrema.
+	for i := 1; i < n-1; i++ {
+		if m[i-1]*m[i] <= 0.0 {
+			continue
+		}
+		w1 := 2.0*h[i] + h[i-1]
+		w2 := h[i] + 2.0*h[i-1]
+		s.d[i] = (w1 + w2) / (w1/m[i-1] + w2/m[i])
+	}
+
+	// Assign end derivatives using a shape-preserving three-point formula.
+	s.d[0] = endDerivative(h[0], h[1], m[0], m[1])
+	s.d[n-1] = endDerivative(h[n-2], h[n-3], m[n-2], m[n-3])
+	return s
+}
+
+// endDerivative estimates the derivative at an end knot from the widths and
+// slopes of the two adjacent intervals, h0/m0 being the outermost.
+func endDerivative(h0, h1, m0, m1 float64) float64 {
+	d := ((2.0*h0+h1)*m0 - h0*m1) / (h0 + h1)
+	switch {
+	case math.Signbit(d) != math.Signbit(m0) || d == 0.0 || m0 == 0.0:
+		return 0.0
+	case math.Signbit(m0) != math.Signbit(m1) && math.Abs(d) > math.Abs(3.0*m0):
+		return 3.0 * m0
+	}
+	return d
+}
+
+// eval evaluates the spline at x.  Points beyond the first and last knots are
+// extrapolated linearly.
+func (s *hermiteSpline) eval(x float64) float64 {
+	n := len(s.kx)
+	switch {
+	case n == 0:
+		return x
+	case n == 1:
+		return s.ky[0]
+	case x <= s.kx[0]:
+		return s.ky[0] + s.d[0]*(x-s.kx[0])
+	case x >= s.kx[n-1]:
+		return s.ky[n-1] + s.d[n-1]*(x-s.kx[n-1])
+	}
+
+	// Locate the interval containing x and evaluate the cubic there.
+	i := sort.SearchFloat64s(s.kx, x)
+	if i > 0 && s.kx[i] != x {
+		i--
+	}
+	if i >= n-1 {
+		i = n - 2
+	}
+	h := s.kx[i+1] - s.kx[i]
+	t := (x - s.kx[i]) / h
+	t2 := t * t
+	t3 := t2 * t
+	h00 := 2.0*t3 - 3.0*t2 + 1.0
+	h10 := t3 - 2.0*t2 + t
+	h01 := -2.0*t3 + 3.0*t2
+	h11 := t3 - t2
+	return h00*s.ky[i] + h10*h*s.d[i] + h01*s.ky[i+1] + h11*h*s.d[i+1]
+}
+
+// invert returns the x at which the spline evaluates to y.  It assumes that
+// the spline is monotonically nondecreasing, as it is for knots taken from a
+// functional mesh.
+func (s *hermiteSpline) invert(y float64) float64 {
+	n := len(s.kx)
+	switch {
+	case n == 0:
+		return y
+	case n == 1:
+		return s.kx[0]
+	case y <= s.ky[0]:
+		if s.d[0] <= 0.0 {
+			return s.kx[0]
+		}
+		return s.kx[0] + (y-s.ky[0])/s.d[0]
+	case y >= s.ky[n-1]:
+		if s.d[n-1] <= 0.0 {
+			return s.kx[n-1]
+		}
+		return s.kx[n-1] + (y-s.ky[n-1])/s.d[n-1]
+	}
+
+	// Locate the interval containing y then bisect within it.
+	i := sort.Search(n, func(j int) bool { return s.ky[j] >= y })
+	if i > 0 {
+		i--
+	}
+	lo, hi := s.kx[i], s.kx[i+1]
+	for k := 0; k < 64 && hi-lo > 1e-9; k++ {
+		mid := (lo + hi) / 2.0
+		if s.eval(mid) < y {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return (lo + hi) / 2.0
+}
+
+// columnSpline returns the spline x = f(y) that libmorph uses to interpolate
+// mesh column c of a 2-D slice of mesh points.
+func columnSpline(pts [][]Point, c int) *hermiteSpline {
+	kx := make([]float64, len(pts))
+	ky := make([]float64, len(pts))
+	for r, row := range pts {
+		kx[r] = row[c].Y
+		ky[r] = row[c].X
+	}
+	return newHermiteSpline(kx, ky)
+}
+
+// rowSpline returns the spline y = f(x) that libmorph uses to interpolate mesh
+// row r of a 2-D slice of mesh points.
+func rowSpline(pts [][]Point, r int) *hermiteSpline {
+	row := pts[r]
+	kx := make([]float64, len(row))
+	ky := make([]float64, len(row))
+	for c, pt := range row {
+		kx[c] = pt.X
+		ky[c] = pt.Y
+	}
+	return newHermiteSpline(kx, ky)
+}
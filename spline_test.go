@@ -0,0 +1,88 @@
+// The functions defined in this file ensure the xmorph package's spline
+// interpolation works as expected.
+
+package xmorph
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// TestSplineKnots ensures that a spline passes through all of its knots.
+func TestSplineKnots(t *testing.T) {
+	rng := rand.New(rand.NewSource(26))
+	const n = 20
+	kx := make([]float64, n)
+	ky := make([]float64, n)
+	for i := range kx {
+		kx[i] = float64(i)*10.0 + rng.Float64()*5.0
+		ky[i] = rng.Float64() * 100.0
+	}
+	s := newHermiteSpline(kx, ky)
+	for i := range kx {
+		if y := s.eval(kx[i]); math.Abs(y-ky[i]) > 1e-9 {
+			t.Fatalf("expected f(%.5g) = %.5g but saw %.5g", kx[i], ky[i], y)
+		}
+	}
+}
+
+// TestSplineLinear ensures that a spline through collinear knots reproduces
+// the line, including when extrapolating.
+func TestSplineLinear(t *testing.T) {
+	kx := []float64{0, 3, 4, 10, 20}
+	ky := make([]float64, len(kx))
+	for i, x := range kx {
+		ky[i] = 2.0*x + 1.0
+	}
+	s := newHermiteSpline(kx, ky)
+	for x := -5.0; x <= 25.0; x += 0.25 {
+		if y := s.eval(x); math.Abs(y-(2.0*x+1.0)) > 1e-9 {
+			t.Fatalf("expected f(%.5g) = %.5g but saw %.5g", x, 2.0*x+1.0, y)
+		}
+	}
+}
+
+// TestSplineMonotonic ensures that a spline through monotonically increasing
+// knots is itself monotonically increasing.
+func TestSplineMonotonic(t *testing.T) {
+	kx := []float64{0, 1, 2, 3, 10, 11, 30}
+	ky := []float64{0, 0.1, 5, 5.1, 5.2, 40, 41}
+	s := newHermiteSpline(kx, ky)
+	prev := s.eval(0.0)
+	for x := 0.01; x <= 30.0; x += 0.01 {
+		y := s.eval(x)
+		if y < prev-1e-12 {
+			t.Fatalf("spline decreased from %.10g to %.10g at x = %.5g", prev, y, x)
+		}
+		prev = y
+	}
+}
+
+// TestSplineDuplicates ensures that unsorted and duplicate knots are
+// tolerated.
+func TestSplineDuplicates(t *testing.T) {
+	s := newHermiteSpline([]float64{4, 0, 2, 2}, []float64{8, 0, 4, 100})
+	for _, x := range []float64{0, 1, 2, 3, 4} {
+		if y := s.eval(x); math.Abs(y-2.0*x) > 1e-9 {
+			t.Fatalf("expected f(%.5g) = %.5g but saw %.5g", x, 2.0*x, y)
+		}
+	}
+}
+
+// TestSplineInvert ensures that inverting a monotonic spline undoes
+// evaluating it, including when extrapolating.
+func TestSplineInvert(t *testing.T) {
+	kx := []float64{0, 1, 2, 3, 10, 11, 30}
+	ky := []float64{0, 2, 5, 5.1, 8, 40, 800}
+	s := newHermiteSpline(kx, ky)
+	if s.d[0] <= 0.0 || s.d[len(kx)-1] <= 0.0 {
+		t.Fatalf("expected positive end derivatives but saw %v", s.d)
+	}
+	for x := -3.0; x <= 33.0; x += 0.1 {
+		y := s.eval(x)
+		if xi := s.invert(y); math.Abs(xi-x) > 1e-6 {
+			t.Fatalf("expected f⁻¹(%.10g) = %.10g but saw %.10g", y, x, xi)
+		}
+	}
+}
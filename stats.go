@@ -0,0 +1,285 @@
+// This file provides statistical operations over collections of meshes, such
+// as averaging, principal component analysis, and distance metrics.
+
+package xmorph
+
+/*
+#include <xmorph/mesh.h>
+#include <xmorph/mesh_t.h>
+*/
+import "C"
+import (
+	"fmt"
+	"math"
+)
+
+// checkMeshesCompatible returns an error if a list of meshes is empty or if
+// any mesh is incompatible with the first, using the same rules as
+// InterpolateMeshes.  fn names the caller for use in error messages.
+func checkMeshesCompatible(ms []*Mesh, fn string) error {
+	if len(ms) == 0 {
+		return fmt.Errorf("no meshes passed to %s", fn)
+	}
+	for _, m := range ms[1:] {
+		if C.meshCompatibilityCheck(ms[0].mesh, m.mesh) != 0 {
+			return fmt.Errorf("incompatible meshes passed to %s", fn)
+		}
+	}
+	return nil
+}
+
+// flattenPoints concatenates the x and y coordinates of each point in a 2-D
+// slice of points in row-major order.
+func flattenPoints(pts [][]Point) []float64 {
+	v := make([]float64, 0, 2*len(pts)*len(pts[0]))
+	for _, row := range pts {
+		for _, pt := range row {
+			v = append(v, pt.X, pt.Y)
+		}
+	}
+	return v
+}
+
+// unflattenPoints is the inverse of flattenPoints.
+func unflattenPoints(v []float64, nx, ny int) [][]Point {
+	pts := make([][]Point, ny)
+	for r := range pts {
+		pts[r] = make([]Point, nx)
+		for c := range pts[r] {
+			i := 2 * (r*nx + c)
+			pts[r][c] = Point{X: v[i], Y: v[i+1]}
+		}
+	}
+	return pts
+}
+
+// MeanMesh returns a mesh whose points are the averages of the corresponding
+// points in a list of compatible meshes.  It returns an error if the list is
+// empty or the meshes are incompatible.
+func MeanMesh(ms []*Mesh) (*Mesh, error) {
+	if err := checkMeshesCompatible(ms, "MeanMesh"); err != nil {
+		return nil, err
+	}
+	sum := make([]float64, 2*ms[0].NX*ms[0].NY)
+	for _, m := range ms {
+		for i, v := range flattenPoints(m.Points()) {
+			sum[i] += v
+		}
+	}
+	for i := range sum {
+		sum[i] /= float64(len(ms))
+	}
+	return MeshFromPoints(unflattenPoints(sum, ms[0].NX, ms[0].NY)), nil
+}
+
+// A MeshPCA is a principal component analysis of the variation among a set
+// of compatible meshes.  Each component is a 2-D slice of point offsets,
+// indexed like the result of Points, with unit norm over all coordinates.
+type MeshPCA struct {
+	Mean       *Mesh       // Mean of the analyzed meshes
+	Components [][][]Point // Principal components in order of decreasing variance
+	Variances  []float64   // Variance of the meshes along each component
+}
+
+// NewMeshPCA performs a principal component analysis of a list of at least
+// two compatible meshes.  Components along which the meshes do not vary are
+// omitted, so at most len(ms)-1 components are returned.
+func NewMeshPCA(ms []*Mesh) (*MeshPCA, error) {
+	if err := checkMeshesCompatible(ms, "NewMeshPCA"); err != nil {
+		return nil, err
+	}
+	if len(ms) < 2 {
+		return nil, fmt.Errorf("NewMeshPCA requires at least 2 meshes (saw %d)", len(ms))
+	}
+	mean, err := MeanMesh(ms)
+	if err != nil {
+		return nil, err
+	}
+	nx, ny := mean.NX, mean.NY
+
+	// Center each mesh about the mean.
+	mu := flattenPoints(mean.Points())
+	n := len(ms)
+	x := make([][]float64, n)
+	for i, m := range ms {
+		x[i] = flattenPoints(m.Points())
+		for j := range x[i] {
+			x[i][j] -= mu[j]
+		}
+	}
+
+	// Because there are typically far fewer meshes than coordinates, we
+	// find the eigenvectors of the small n×n Gram matrix and map them to
+	// the principal components.
+	gram := make([][]float64, n)
+	for i := range gram {
+		gram[i] = make([]float64, n)
+		for j := 0; j <= i; j++ {
+			s := 0.0
+			for k := range x[i] {
+				s += x[i][k] * x[j][k]
+			}
+			gram[i][j] = s
+			gram[j][i] = s
+		}
+	}
+	vals, vecs := symmetricEigen(gram)
+	pca := &MeshPCA{Mean: mean}
+	tol := 1e-9 * math.Max(vals[0], 1.0)
+	for k, lambda := range vals {
+		if lambda <= tol || k >= n-1 {
+			break
+		}
+		comp := make([]float64, len(mu))
+		for i, u := range vecs[k] {
+			for j, v := range x[i] {
+				comp[j] += u * v
+			}
+		}
+		norm := math.Sqrt(lambda)
+		for j := range comp {
+			comp[j] /= norm
+		}
+		pca.Components = append(pca.Components, unflattenPoints(comp, nx, ny))
+		pca.Variances = append(pca.Variances, lambda/float64(n-1))
+	}
+	return pca, nil
+}
+
+// Project returns the coefficients of a mesh along each principal
+// component.  It returns an error if the mesh is incompatible with the
+// analyzed meshes.
+func (pca *MeshPCA) Project(m *Mesh) ([]float64, error) {
+	if err := checkMeshesCompatible([]*Mesh{pca.Mean, m}, "Project"); err != nil {
+		return nil, err
+	}
+	mu := flattenPoints(pca.Mean.Points())
+	v := flattenPoints(m.Points())
+	coeffs := make([]float64, len(pca.Components))
+	for k, comp := range pca.Components {
+		for j, cv := range flattenPoints(comp) {
+			coeffs[k] += cv * (v[j] - mu[j])
+		}
+	}
+	return coeffs, nil
+}
+
+// Reconstruct returns the mean mesh plus a weighted sum of principal
+// components.  coeffs may contain fewer values than there are components, in
+// which case the remaining components are given zero weight.
+func (pca *MeshPCA) Reconstruct(coeffs []float64) *Mesh {
+	if len(coeffs) > len(pca.Components) {
+		panic(fmt.Sprintf("%d coefficients were provided for %d components", len(coeffs), len(pca.Components)))
+	}
+	v := flattenPoints(pca.Mean.Points())
+	for k, w := range coeffs {
+		for j, cv := range flattenPoints(pca.Components[k]) {
+			v[j] += w * cv
+		}
+	}
+	return MeshFromPoints(unflattenPoints(v, pca.Mean.NX, pca.Mean.NY))
+}
+
+// pointDistances returns the distance between each pair of corresponding
+// points in two compatible meshes.
+func pointDistances(a, b *Mesh, fn string) ([]float64, error) {
+	if err := checkMeshesCompatible([]*Mesh{a, b}, fn); err != nil {
+		return nil, err
+	}
+	ap, bp := a.Points(), b.Points()
+	ds := make([]float64, 0, a.NX*a.NY)
+	for r, row := range ap {
+		for c, pt := range row {
+			ds = append(ds, math.Hypot(pt.X-bp[r][c].X, pt.Y-bp[r][c].Y))
+		}
+	}
+	return ds, nil
+}
+
+// RMSDistance returns the root-mean-square distance between corresponding
+// points in two compatible meshes.
+func RMSDistance(a, b *Mesh) (float64, error) {
+	ds, err := pointDistances(a, b, "RMSDistance")
+	if err != nil {
+		return 0.0, err
+	}
+	sum := 0.0
+	for _, d := range ds {
+		sum += d * d
+	}
+	return math.Sqrt(sum / float64(len(ds))), nil
+}
+
+// MaxDisplacement returns the largest distance between corresponding points
+// in two compatible meshes.
+func MaxDisplacement(a, b *Mesh) (float64, error) {
+	ds, err := pointDistances(a, b, "MaxDisplacement")
+	if err != nil {
+		return 0.0, err
+	}
+	max := 0.0
+	for _, d := range ds {
+		max = math.Max(max, d)
+	}
+	return max, nil
+}
+
+// normalizeShape translates a set of points to have a centroid of (0, 0) and
+// scales them to have unit root-sum-square distance from the origin.  It
+// returns the normalized points along with the original centroid and scale.
+func normalizeShape(pts []Point) ([]Point, Point, float64) {
+	var c Point
+	for _, p := range pts {
+		c = c.Add(p)
+	}
+	c = c.Div(float64(len(pts)))
+	s := 0.0
+	for _, p := range pts {
+		d := p.Sub(c)
+		s += d.X*d.X + d.Y*d.Y
+	}
+	s = math.Sqrt(s)
+	out := make([]Point, len(pts))
+	for i, p := range pts {
+		out[i] = p.Sub(c)
+		if s > 0.0 {
+			out[i] = out[i].Div(s)
+		}
+	}
+	return out, c, s
+}
+
+// ProcrustesDistance returns the full Procrustes distance between two
+// compatible meshes: the residual distance between their points after each
+// mesh is centered and scaled to unit size and the first is optimally
+// rotated onto the second.  The result lies in [0, 1] and is zero if and
+// only if the meshes differ by a similarity transformation.
+func ProcrustesDistance(a, b *Mesh) (float64, error) {
+	if err := checkMeshesCompatible([]*Mesh{a, b}, "ProcrustesDistance"); err != nil {
+		return 0.0, err
+	}
+	ap, _, as := normalizeShape(flattenMesh(a))
+	bp, _, bs := normalizeShape(flattenMesh(b))
+	if as == 0.0 || bs == 0.0 {
+		return 0.0, fmt.Errorf("ProcrustesDistance requires meshes with nonzero extent")
+	}
+
+	// Treating points as complex numbers, the optimal rotation aligns a
+	// with b, and the residual is √(1 - |Σ conj(a)·b|²).
+	re, im := 0.0, 0.0
+	for i, p := range ap {
+		q := bp[i]
+		re += p.X*q.X + p.Y*q.Y
+		im += p.X*q.Y - p.Y*q.X
+	}
+	return math.Sqrt(math.Max(0.0, 1.0-(re*re+im*im))), nil
+}
+
+// flattenMesh returns a mesh's points as a 1-D slice in row-major order.
+func flattenMesh(m *Mesh) []Point {
+	pts := make([]Point, 0, m.NX*m.NY)
+	for _, row := range m.Points() {
+		pts = append(pts, row...)
+	}
+	return pts
+}
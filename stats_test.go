@@ -0,0 +1,170 @@
+// The functions defined in this file ensure the xmorph package's mesh
+// statistics work as expected.
+
+package xmorph
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// TestMeanMesh ensures that MeanMesh averages corresponding points and
+// rejects incompatible meshes.
+func TestMeanMesh(t *testing.T) {
+	const nx, ny, wd, ht = 5, 4, 100, 80
+	rng := rand.New(rand.NewSource(39))
+	ms := []*Mesh{
+		jaggedMesh(rng, nx, ny, wd, ht, 0.3),
+		jaggedMesh(rng, nx, ny, wd, ht, 0.3),
+		jaggedMesh(rng, nx, ny, wd, ht, 0.3),
+	}
+	for _, m := range ms {
+		defer m.Free()
+	}
+	mean, err := MeanMesh(ms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mean.Free()
+	for r := 0; r < ny; r++ {
+		for c := 0; c < nx; c++ {
+			want := ms[0].Get(c, r).Add(ms[1].Get(c, r)).Add(ms[2].Get(c, r)).Div(3.0)
+			if got := mean.Get(c, r); !got.Eq(want, 1e-9) {
+				t.Fatalf("expected %v at (%d, %d) but saw %v", want, c, r, got)
+			}
+		}
+	}
+	other := NewRegularMesh(nx+1, ny, wd, ht)
+	defer other.Free()
+	if _, err := MeanMesh(append(ms, other)); err == nil {
+		t.Fatal("expected incompatible meshes to be rejected")
+	}
+	if _, err := MeanMesh(nil); err == nil {
+		t.Fatal("expected an empty list of meshes to be rejected")
+	}
+}
+
+// TestMeshPCA ensures that PCA recovers the modes of variation of meshes
+// constructed from two known modes.
+func TestMeshPCA(t *testing.T) {
+	const nx, ny, wd, ht = 6, 5, 100, 80
+	base := NewRegularMesh(nx, ny, wd, ht)
+	defer base.Free()
+	bp := base.Points()
+
+	// Mode 1 moves interior points horizontally; mode 2 moves them
+	// vertically.  Both have unit norm.
+	nInt := float64((nx - 2) * (ny - 2))
+	mode := func(dir Point) [][]Point {
+		md := make([][]Point, ny)
+		for r := range md {
+			md[r] = make([]Point, nx)
+			for c := range md[r] {
+				if r > 0 && c > 0 && r < ny-1 && c < nx-1 {
+					md[r][c] = dir.Div(math.Sqrt(nInt))
+				}
+			}
+		}
+		return md
+	}
+	modes := [][][]Point{mode(Point{X: 1}), mode(Point{Y: 1})}
+
+	// Choose weights for the two modes that are uncorrelated and have
+	// zero mean.
+	var ms []*Mesh
+	for i := 0; i < 10; i++ {
+		sin, cos := math.Sincos(2.0 * math.Pi * float64(i) / 10.0)
+		w := []float64{cos * 20.0, sin * 5.0}
+		pts := make([][]Point, ny)
+		for r := range pts {
+			pts[r] = make([]Point, nx)
+			for c := range pts[r] {
+				pts[r][c] = bp[r][c].Add(modes[0][r][c].Mul(w[0])).Add(modes[1][r][c].Mul(w[1]))
+			}
+		}
+		m := MeshFromPoints(pts)
+		defer m.Free()
+		ms = append(ms, m)
+	}
+	pca, err := NewMeshPCA(ms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pca.Mean.Free()
+	if len(pca.Components) != 2 || len(pca.Variances) != 2 {
+		t.Fatalf("expected 2 components but saw %d", len(pca.Components))
+	}
+	if pca.Variances[0] < pca.Variances[1] {
+		t.Fatalf("expected variances in decreasing order but saw %v", pca.Variances)
+	}
+
+	// The first component should match the first mode up to sign.
+	dot := 0.0
+	for r := range modes[0] {
+		for c := range modes[0][r] {
+			a, b := modes[0][r][c], pca.Components[0][r][c]
+			dot += a.X*b.X + a.Y*b.Y
+		}
+	}
+	if math.Abs(math.Abs(dot)-1.0) > 1e-6 {
+		t.Fatalf("expected the first component to match the first mode but saw a dot product of %v", dot)
+	}
+
+	// Projecting and reconstructing should reproduce each mesh.
+	for _, m := range ms {
+		coeffs, err := pca.Project(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rm := pca.Reconstruct(coeffs)
+		if d, err := MaxDisplacement(m, rm); err != nil || d > 1e-6 {
+			t.Fatalf("expected a reconstruction error of 0 but saw %v (%v)", d, err)
+		}
+		rm.Free()
+	}
+	if _, err := NewMeshPCA(ms[:1]); err == nil {
+		t.Fatal("expected a single mesh to be rejected")
+	}
+}
+
+// TestMeshDistances ensures that the distance metrics return expected
+// values for simple transformations.
+func TestMeshDistances(t *testing.T) {
+	const nx, ny, wd, ht = 5, 5, 100, 100
+	rng := rand.New(rand.NewSource(391))
+	a := jaggedMesh(rng, nx, ny, wd, ht, 0.3)
+	defer a.Free()
+
+	// Translate every point by (3, 4).
+	b := MeshFromPoints(a.Points())
+	defer b.Free()
+	b.Transform(NewTranslation(3, 4), false)
+	if d, err := RMSDistance(a, b); err != nil || math.Abs(d-5.0) > 1e-9 {
+		t.Fatalf("expected an RMS distance of 5 but saw %v (%v)", d, err)
+	}
+	if d, err := MaxDisplacement(a, b); err != nil || math.Abs(d-5.0) > 1e-9 {
+		t.Fatalf("expected a maximum displacement of 5 but saw %v (%v)", d, err)
+	}
+
+	// A similarity transformation should have zero Procrustes distance.
+	c := MeshFromPoints(a.Points())
+	defer c.Free()
+	c.Transform(NewRotation(0.3, Point{X: 50, Y: 50}).Then(NewScaling(1.7, 1.7, Point{})).Then(NewTranslation(-8, 11)), false)
+	if d, err := ProcrustesDistance(a, c); err != nil || d > 1e-6 {
+		t.Fatalf("expected a Procrustes distance of 0 but saw %v (%v)", d, err)
+	}
+
+	// A non-similarity transformation should not.
+	e := MeshFromPoints(a.Points())
+	defer e.Free()
+	e.Transform(NewShear(0.4, 0, Point{}), false)
+	if d, err := ProcrustesDistance(a, e); err != nil || d < 0.05 || d > 1.0 {
+		t.Fatalf("expected a Procrustes distance in [0.05, 1] but saw %v (%v)", d, err)
+	}
+	other := NewRegularMesh(nx, ny+1, wd, ht)
+	defer other.Free()
+	if _, err := RMSDistance(a, other); err == nil {
+		t.Fatal("expected incompatible meshes to be rejected")
+	}
+}
@@ -0,0 +1,237 @@
+// This file provides a function that tracks a mesh across the frames of a
+// video.
+
+package xmorph
+
+import (
+	"fmt"
+	"image"
+	"math"
+)
+
+// TrackOptions control the mesh tracking performed by TrackMesh.
+type TrackOptions struct {
+	Flow     FlowOptions // Pyramid, window, iteration, and smoothing parameters
+	Temporal float64     // Weight in [0.0, 1.0) given to each point's previous motion
+}
+
+// These constants control how tracking confidence is computed.
+const (
+	trackTextureScale  = 1e-4 // Minimum eigenvalue of the structure tensor at which texture confidence is 0.5
+	trackResidualScale = 0.05 // RMS luminance residual at which match confidence is 1/e
+)
+
+// trackPoint tracks a single point from image a to image b using pyramidal
+// Lucas–Kanade matching of a square patch of radius rad.  It begins with an
+// initial guess at the point's displacement and returns the refined
+// displacement and a confidence in [0.0, 1.0] that combines the amount of
+// texture in the patch with how well the patch matches.
+func trackPoint(pyrA, pyrB []*lumaImage, p, guess Point, rad, iters int) (Point, float64) {
+	d := guess.Div(math.Pow(2.0, float64(len(pyrA)-1)))
+	var gxx, gxy, gyy float64
+	for l := len(pyrA) - 1; l >= 0; l-- {
+		a, b := pyrA[l], pyrB[l]
+		scale := math.Pow(2.0, float64(l))
+		q := Point{X: (p.X+0.5)/scale - 0.5, Y: (p.Y+0.5)/scale - 0.5}
+		if l < len(pyrA)-1 {
+			d = d.Mul(2.0)
+		}
+
+		// Compute the structure tensor and gradients over the patch.
+		n := (2*rad + 1) * (2*rad + 1)
+		ax := make([]float64, 0, n)
+		gx := make([]float64, 0, n)
+		gy := make([]float64, 0, n)
+		gxx, gxy, gyy = 0.0, 0.0, 0.0
+		for j := -rad; j <= rad; j++ {
+			for i := -rad; i <= rad; i++ {
+				x, y := q.X+float64(i), q.Y+float64(j)
+				dx := (a.sample(x+1, y) - a.sample(x-1, y)) / 2.0
+				dy := (a.sample(x, y+1) - a.sample(x, y-1)) / 2.0
+				ax = append(ax, a.sample(x, y))
+				gx = append(gx, dx)
+				gy = append(gy, dy)
+				gxx += dx * dx
+				gxy += dx * dy
+				gyy += dy * dy
+			}
+		}
+		det := gxx*gyy - gxy*gxy
+		if det < 1e-12 {
+			continue // Too little texture to refine the displacement
+		}
+
+		// Iteratively refine the displacement.
+		for it := 0; it < iters; it++ {
+			var bx, by float64
+			k := 0
+			for j := -rad; j <= rad; j++ {
+				for i := -rad; i <= rad; i++ {
+					dt := b.sample(q.X+float64(i)+d.X, q.Y+float64(j)+d.Y) - ax[k]
+					bx -= gx[k] * dt
+					by -= gy[k] * dt
+					k++
+				}
+			}
+			step := Point{X: (gyy*bx - gxy*by) / det, Y: (gxx*by - gxy*bx) / det}
+			d = d.Add(step)
+			if math.Hypot(step.X, step.Y) < 0.01 {
+				break
+			}
+		}
+	}
+
+	// Compute a confidence from the texture and the residual at full
+	// resolution.
+	a, b := pyrA[0], pyrB[0]
+	n := float64((2*rad + 1) * (2*rad + 1))
+	gxx, gxy, gyy = gxx/n, gxy/n, gyy/n
+	lmin := (gxx+gyy)/2.0 - math.Sqrt((gxx-gyy)*(gxx-gyy)/4.0+gxy*gxy)
+	resid := 0.0
+	for j := -rad; j <= rad; j++ {
+		for i := -rad; i <= rad; i++ {
+			x, y := p.X+float64(i), p.Y+float64(j)
+			dt := b.sample(x+d.X, y+d.Y) - a.sample(x, y)
+			resid += dt * dt
+		}
+	}
+	rms := math.Sqrt(resid/n) / trackResidualScale
+	conf := math.Max(lmin, 0.0) / (math.Max(lmin, 0.0) + trackTextureScale) * math.Exp(-rms*rms)
+	return d, conf
+}
+
+// TrackMesh tracks a mesh drawn on frames[0] through the remaining frames of
+// a video and returns one mesh per frame along with a confidence in
+// [0.0, 1.0] for each point in each frame, indexed [frame][row][column].
+// Each interior point is tracked from one frame to the next by pyramidal
+// Lucas–Kanade matching of the image patch around it, with opts.Flow
+// controlling the pyramid and patch.  A point's confidence is high when its
+// patch is well textured and matches closely.  Low-confidence points follow
+// the confidence-weighted motion of their neighbors, and opts.Temporal
+// blends each point's motion with its motion in the previous frame (if any)
+// to reduce jitter.  Edge points are left unchanged and have confidence
+// 1.0.  Each mesh is then smoothed according to opts.Flow.Smooth (with
+// SmoothTaubin) and passed through Functionalize.  All returned meshes have
+// the same dimensions and labels as m, so any two are compatible for
+// InterpolateMeshes.  The first returned mesh is a copy of m, with
+// confidence 1.0 everywhere.
+func TrackMesh(m *Mesh, frames []image.Image, opts TrackOptions) ([]*Mesh, [][][]float64, error) {
+	// Check the arguments.
+	if len(frames) == 0 {
+		return nil, nil, fmt.Errorf("no frames passed to TrackMesh")
+	}
+	if opts.Temporal < 0.0 || opts.Temporal >= 1.0 {
+		return nil, nil, fmt.Errorf("temporal weight %.5g does not lie in the range [0.0, 1.0)", opts.Temporal)
+	}
+	bnds := frames[0].Bounds()
+	wd, ht := bnds.Dx(), bnds.Dy()
+	for i, f := range frames[1:] {
+		if b := f.Bounds(); b.Dx() != wd || b.Dy() != ht {
+			return nil, nil, fmt.Errorf("frame %d is %dx%d but frame 0 is %dx%d", i+1, b.Dx(), b.Dy(), wd, ht)
+		}
+	}
+	fopts, err := opts.Flow.withDefaults(wd, ht)
+	if err != nil {
+		return nil, nil, err
+	}
+	if fopts.Smooth.Iterations > 0 {
+		if err := fopts.Smooth.validate(m); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Frame 0 is given.
+	nx, ny := m.NX, m.NY
+	newConf := func(v float64) [][]float64 {
+		conf := make([][]float64, ny)
+		for r := range conf {
+			conf[r] = make([]float64, nx)
+			for c := range conf[r] {
+				conf[r][c] = v
+			}
+		}
+		return conf
+	}
+	labels := m.meshLabels()
+	meshes := []*Mesh{m.Copy()}
+	confs := [][][]float64{newConf(1.0)}
+	vel := make([][]Point, ny)
+	for r := range vel {
+		vel[r] = make([]Point, nx)
+	}
+
+	// Track each subsequent frame.
+	pyrA := newLumaImage(frames[0]).pyramid(fopts.Levels)
+	for k, frame := range frames[1:] {
+		pyrB := newLumaImage(frame).pyramid(fopts.Levels)
+		prev := meshes[len(meshes)-1].Points()
+
+		// Measure each interior point's displacement.
+		disp := make([][]Point, ny)
+		conf := newConf(1.0)
+		for r := range disp {
+			disp[r] = make([]Point, nx)
+			if r == 0 || r == ny-1 {
+				continue
+			}
+			for c := 1; c < nx-1; c++ {
+				disp[r][c], conf[r][c] = trackPoint(pyrA, pyrB, prev[r][c], vel[r][c], fopts.WindowRadius, fopts.Iterations)
+			}
+		}
+
+		// Blend each point's displacement with its neighbors' according
+		// to its confidence, then with its previous motion.
+		pts := make([][]Point, ny)
+		for r := range pts {
+			pts[r] = append([]Point(nil), prev[r]...)
+			if r == 0 || r == ny-1 {
+				continue
+			}
+			for c := 1; c < nx-1; c++ {
+				var sum Point
+				wt := 0.0
+				for j := r - 1; j <= r+1; j++ {
+					for i := c - 1; i <= c+1; i++ {
+						if j > 0 && j < ny-1 && i > 0 && i < nx-1 {
+							sum = sum.Add(disp[j][i].Mul(conf[j][i]))
+							wt += conf[j][i]
+						}
+					}
+				}
+				d := disp[r][c].Mul(conf[r][c])
+				if wt > 0.0 {
+					d = d.Add(sum.Div(wt).Mul(1.0 - conf[r][c]))
+				}
+				if k > 0 {
+					d = d.Mul(1.0 - opts.Temporal).Add(vel[r][c].Mul(opts.Temporal))
+				}
+				pts[r][c] = prev[r][c].Add(d)
+			}
+		}
+
+		// Clean up the mesh.
+		tm := meshFromGrid(pts, labels)
+		if fopts.Smooth.Iterations > 0 {
+			if err := tm.SmoothTaubin(fopts.Smooth); err != nil {
+				tm.Free()
+				for _, mm := range meshes {
+					mm.Free()
+				}
+				return nil, nil, err
+			}
+		}
+		tm.Functionalize(wd, ht)
+
+		// Record each point's motion as it was finally placed, which
+		// seeds the next frame's tracking and temporal blending.
+		for r, row := range tm.Points() {
+			for c, pt := range row {
+				vel[r][c] = pt.Sub(prev[r][c])
+			}
+		}
+		meshes = append(meshes, tm)
+		confs = append(confs, conf)
+		pyrA = pyrB
+	}
+	return meshes, confs, nil
+}
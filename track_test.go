@@ -0,0 +1,109 @@
+// The functions defined in this file ensure the xmorph package's mesh
+// tracking works as expected.
+
+package xmorph
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+// TestTrackMesh ensures that a mesh follows moving image content and that
+// confidence reflects the presence of texture.
+func TestTrackMesh(t *testing.T) {
+	const wd, ht, nf = 128, 96, 5
+	frames := make([]image.Image, nf)
+	for k := range frames {
+		dx, dy := 2.0*float64(k), float64(k)
+		frames[k] = textureImage(wd, ht, func(x, y float64) (float64, float64) { return x - dx, y - dy })
+	}
+	m := NewRegularMesh(6, 5, wd, ht)
+	defer m.Free()
+	m.SetLabel(2, 2, 4)
+	meshes, confs, err := TrackMesh(m, frames, TrackOptions{Temporal: 0.3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		for _, tm := range meshes {
+			tm.Free()
+		}
+	}()
+	if len(meshes) != nf || len(confs) != nf {
+		t.Fatalf("expected %d meshes and confidences but saw %d and %d", nf, len(meshes), len(confs))
+	}
+	for k, tm := range meshes {
+		if tm.GetLabel(2, 2) != 4 {
+			t.Fatalf("expected labels to be preserved in frame %d", k)
+		}
+		for r := 1; r < tm.NY-1; r++ {
+			for c := 1; c < tm.NX-1; c++ {
+				want := m.Get(c, r).Add(Point{X: 2.0 * float64(k), Y: float64(k)})
+				if p := tm.Get(c, r); math.Hypot(p.X-want.X, p.Y-want.Y) > 0.5 {
+					t.Fatalf("expected %v at (%d, %d) in frame %d but saw %v", want, c, r, k, p)
+				}
+				if confs[k][r][c] < 0.5 {
+					t.Fatalf("expected high confidence at (%d, %d) in frame %d but saw %v", c, r, k, confs[k][r][c])
+				}
+			}
+		}
+	}
+	mid, err := InterpolateMeshes(meshes[0], meshes[nf-1], 0.5)
+	if err != nil {
+		t.Fatalf("expected compatible meshes (%v)", err)
+	}
+	mid.Free()
+
+	// Invalid arguments should be rejected.
+	if _, _, err := TrackMesh(m, nil, TrackOptions{}); err == nil {
+		t.Fatal("expected an empty frame list to be rejected")
+	}
+	if _, _, err := TrackMesh(m, frames, TrackOptions{Temporal: 1}); err == nil {
+		t.Fatal("expected a temporal weight of 1 to be rejected")
+	}
+	bad := append([]image.Image{}, frames[0], image.NewGray(image.Rect(0, 0, 10, 10)))
+	if _, _, err := TrackMesh(m, bad, TrackOptions{}); err == nil {
+		t.Fatal("expected frames of different sizes to be rejected")
+	}
+}
+
+// TestTrackMeshFlat ensures that points in featureless regions receive low
+// confidence and follow their neighbors.
+func TestTrackMeshFlat(t *testing.T) {
+	const wd, ht = 128, 96
+	frames := make([]image.Image, 2)
+	for k := range frames {
+		dx := 2.0 * float64(k)
+		img := textureImage(wd, ht, func(x, y float64) (float64, float64) { return x - dx, y })
+		for y := 0; y < ht; y++ {
+			for x := 64; x < wd; x++ {
+				img.SetGray16(x, y, color.Gray16{Y: 0x8000})
+			}
+		}
+		frames[k] = img
+	}
+	m := NewRegularMesh(7, 5, wd, ht)
+	defer m.Free()
+	meshes, confs, err := TrackMesh(m, frames, TrackOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		for _, tm := range meshes {
+			tm.Free()
+		}
+	}()
+	for r := 1; r < m.NY-1; r++ {
+		if cf := confs[1][r][1]; cf < 0.5 {
+			t.Fatalf("expected high confidence in the textured region but saw %v", cf)
+		}
+		if cf := confs[1][r][5]; cf > 0.1 {
+			t.Fatalf("expected low confidence in the flat region but saw %v", cf)
+		}
+		if p, q := meshes[1].Get(5, r), m.Get(5, r); math.Abs(p.X-q.X) > 0.5 || math.Abs(p.Y-q.Y) > 0.5 {
+			t.Fatalf("expected an isolated flat-region point to stay near %v but saw %v", q, p)
+		}
+	}
+}
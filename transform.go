@@ -0,0 +1,316 @@
+// This file provides affine and projective transformations of points and
+// meshes.
+
+package xmorph
+
+import (
+	"fmt"
+	"math"
+)
+
+// A Transform maps one Point to another.
+type Transform interface {
+	Apply(p Point) Point
+}
+
+// An Affine is a 2-D affine transformation represented by the first two rows
+// of a 3×3 matrix in row-major order.  It maps (x, y) to (a[0]·x + a[1]·y +
+// a[2], a[3]·x + a[4]·y + a[5]).
+type Affine [6]float64
+
+// IdentityAffine returns an Affine that leaves all points unchanged.
+func IdentityAffine() Affine {
+	return Affine{1, 0, 0, 0, 1, 0}
+}
+
+// NewTranslation returns an Affine that translates by (dx, dy).
+func NewTranslation(dx, dy float64) Affine {
+	return Affine{1, 0, dx, 0, 1, dy}
+}
+
+// NewScaling returns an Affine that scales by sx horizontally and sy
+// vertically about a given center point.
+func NewScaling(sx, sy float64, c Point) Affine {
+	return Affine{sx, 0, c.X - sx*c.X, 0, sy, c.Y - sy*c.Y}
+}
+
+// NewRotation returns an Affine that rotates by theta radians about a given
+// center point.  Because the y axis increases downwards, positive angles
+// rotate clockwise on the screen.
+func NewRotation(theta float64, c Point) Affine {
+	s, co := math.Sincos(theta)
+	return Affine{
+		co, -s, c.X - co*c.X + s*c.Y,
+		s, co, c.Y - s*c.X - co*c.Y,
+	}
+}
+
+// NewShear returns an Affine that shears x by kx·y and y by ky·x relative to a
+// given center point.
+func NewShear(kx, ky float64, c Point) Affine {
+	return Affine{1, kx, -kx * c.Y, ky, 1, -ky * c.X}
+}
+
+// Apply applies an affine transformation to a Point.
+func (a Affine) Apply(p Point) Point {
+	return Point{
+		X: a[0]*p.X + a[1]*p.Y + a[2],
+		Y: a[3]*p.X + a[4]*p.Y + a[5],
+	}
+}
+
+// Then returns the Affine that applies a and then b.
+func (a Affine) Then(b Affine) Affine {
+	return Affine{
+		b[0]*a[0] + b[1]*a[3], b[0]*a[1] + b[1]*a[4], b[0]*a[2] + b[1]*a[5] + b[2],
+		b[3]*a[0] + b[4]*a[3], b[3]*a[1] + b[4]*a[4], b[3]*a[2] + b[4]*a[5] + b[5],
+	}
+}
+
+// Inverse returns the Affine that undoes a.  It returns an error if a is
+// singular.
+func (a Affine) Inverse() (Affine, error) {
+	det := a[0]*a[4] - a[1]*a[3]
+	if math.Abs(det) < 1e-12 {
+		return Affine{}, fmt.Errorf("affine transformation is not invertible")
+	}
+	i0, i1 := a[4]/det, -a[1]/det
+	i3, i4 := -a[3]/det, a[0]/det
+	return Affine{
+		i0, i1, -(i0*a[2] + i1*a[5]),
+		i3, i4, -(i3*a[2] + i4*a[5]),
+	}, nil
+}
+
+// Homography converts an Affine to an equivalent Homography.
+func (a Affine) Homography() Homography {
+	return Homography{a[0], a[1], a[2], a[3], a[4], a[5], 0, 0, 1}
+}
+
+// A Homography is a 2-D projective transformation represented by a 3×3 matrix
+// in row-major order.  It maps (x, y) to ((h[0]·x + h[1]·y + h[2])/w, (h[3]·x
+// + h[4]·y + h[5])/w), where w = h[6]·x + h[7]·y + h[8].
+type Homography [9]float64
+
+// IdentityHomography returns a Homography that leaves all points unchanged.
+func IdentityHomography() Homography {
+	return Homography{1, 0, 0, 0, 1, 0, 0, 0, 1}
+}
+
+// Apply applies a projective transformation to a Point.
+func (h Homography) Apply(p Point) Point {
+	w := h[6]*p.X + h[7]*p.Y + h[8]
+	return Point{
+		X: (h[0]*p.X + h[1]*p.Y + h[2]) / w,
+		Y: (h[3]*p.X + h[4]*p.Y + h[5]) / w,
+	}
+}
+
+// Then returns the Homography that applies h and then g.
+func (h Homography) Then(g Homography) Homography {
+	var r Homography
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			for k := 0; k < 3; k++ {
+				r[i*3+j] += g[i*3+k] * h[k*3+j]
+			}
+		}
+	}
+	return r.normalized()
+}
+
+// normalized scales a Homography so its bottom-right element is 1, if
+// possible.
+func (h Homography) normalized() Homography {
+	if h[8] == 0.0 {
+		return h
+	}
+	s := h[8]
+	for i := range h {
+		h[i] /= s
+	}
+	return h
+}
+
+// Inverse returns the Homography that undoes h.  It returns an error if h is
+// singular.
+func (h Homography) Inverse() (Homography, error) {
+	c00 := h[4]*h[8] - h[5]*h[7]
+	c01 := h[5]*h[6] - h[3]*h[8]
+	c02 := h[3]*h[7] - h[4]*h[6]
+	det := h[0]*c00 + h[1]*c01 + h[2]*c02
+	if math.Abs(det) < 1e-12 {
+		return Homography{}, fmt.Errorf("projective transformation is not invertible")
+	}
+	inv := Homography{
+		c00, h[2]*h[7] - h[1]*h[8], h[1]*h[5] - h[2]*h[4],
+		c01, h[0]*h[8] - h[2]*h[6], h[2]*h[3] - h[0]*h[5],
+		c02, h[1]*h[6] - h[0]*h[7], h[0]*h[4] - h[1]*h[3],
+	}
+	for i := range inv {
+		inv[i] /= det
+	}
+	return inv.normalized(), nil
+}
+
+// FitAffine returns the Affine that maps src[i] to dst[i] with the least
+// squared error.  At least three non-collinear point pairs are required.
+func FitAffine(src, dst []Point) (Affine, error) {
+	if len(src) != len(dst) {
+		return Affine{}, fmt.Errorf("FitAffine requires equal numbers of source and destination points (saw %d and %d)", len(src), len(dst))
+	}
+	if len(src) < 3 {
+		return Affine{}, fmt.Errorf("FitAffine requires at least 3 point pairs (saw %d)", len(src))
+	}
+	a := make([][]float64, len(src))
+	bx := make([]float64, len(src))
+	by := make([]float64, len(src))
+	for i, p := range src {
+		a[i] = []float64{p.X, p.Y, 1}
+		bx[i] = dst[i].X
+		by[i] = dst[i].Y
+	}
+	rx, err := leastSquares(a, bx)
+	if err != nil {
+		return Affine{}, fmt.Errorf("failed to fit an affine transformation (%w)", err)
+	}
+	ry, err := leastSquares(a, by)
+	if err != nil {
+		return Affine{}, fmt.Errorf("failed to fit an affine transformation (%w)", err)
+	}
+	return Affine{rx[0], rx[1], rx[2], ry[0], ry[1], ry[2]}, nil
+}
+
+// FitSimilarity returns the similarity transformation (a combination of
+// rotation, uniform scaling, and translation) that maps src[i] to dst[i] with
+// the least squared error.  At least two distinct source points are
+// required.
+func FitSimilarity(src, dst []Point) (Affine, error) {
+	if len(src) != len(dst) {
+		return Affine{}, fmt.Errorf("FitSimilarity requires equal numbers of source and destination points (saw %d and %d)", len(src), len(dst))
+	}
+	if len(src) < 2 {
+		return Affine{}, fmt.Errorf("FitSimilarity requires at least 2 point pairs (saw %d)", len(src))
+	}
+	var cs, cd Point
+	for i := range src {
+		cs = cs.Add(src[i])
+		cd = cd.Add(dst[i])
+	}
+	cs = cs.Div(float64(len(src)))
+	cd = cd.Div(float64(len(dst)))
+
+	// Treating points as complex numbers, the optimal rotation and scale
+	// is Σ conj(s)·d / Σ |s|² over the centered points.
+	re, im, den := 0.0, 0.0, 0.0
+	for i := range src {
+		s, d := src[i].Sub(cs), dst[i].Sub(cd)
+		re += s.X*d.X + s.Y*d.Y
+		im += s.X*d.Y - s.Y*d.X
+		den += s.X*s.X + s.Y*s.Y
+	}
+	if den < 1e-12 {
+		return Affine{}, fmt.Errorf("FitSimilarity requires at least 2 distinct source points")
+	}
+	a, b := re/den, im/den
+	return Affine{
+		a, -b, cd.X - a*cs.X + b*cs.Y,
+		b, a, cd.Y - b*cs.X - a*cs.Y,
+	}, nil
+}
+
+// normalizingAffine returns an Affine that translates a set of points to have
+// a centroid of (0, 0) and scales them to have a mean distance of √2 from the
+// origin, which improves the conditioning of homography fitting.
+func normalizingAffine(pts []Point) Affine {
+	var c Point
+	for _, p := range pts {
+		c = c.Add(p)
+	}
+	c = c.Div(float64(len(pts)))
+	d := 0.0
+	for _, p := range pts {
+		d += math.Hypot(p.X-c.X, p.Y-c.Y)
+	}
+	d /= float64(len(pts))
+	s := 1.0
+	if d > 0.0 {
+		s = math.Sqrt2 / d
+	}
+	return Affine{s, 0, -s * c.X, 0, s, -s * c.Y}
+}
+
+// FitHomography returns the Homography that maps src[i] to dst[i] with the
+// least algebraic error.  At least four point pairs, no three of which are
+// collinear, are required.
+func FitHomography(src, dst []Point) (Homography, error) {
+	if len(src) != len(dst) {
+		return Homography{}, fmt.Errorf("FitHomography requires equal numbers of source and destination points (saw %d and %d)", len(src), len(dst))
+	}
+	if len(src) < 4 {
+		return Homography{}, fmt.Errorf("FitHomography requires at least 4 point pairs (saw %d)", len(src))
+	}
+
+	// Normalize both point sets.
+	ns, nd := normalizingAffine(src), normalizingAffine(dst)
+
+	// Solve for the first eight matrix elements, fixing the ninth at 1.
+	a := make([][]float64, 0, 2*len(src))
+	b := make([]float64, 0, 2*len(src))
+	for i := range src {
+		p, q := ns.Apply(src[i]), nd.Apply(dst[i])
+		a = append(a,
+			[]float64{p.X, p.Y, 1, 0, 0, 0, -q.X * p.X, -q.X * p.Y},
+			[]float64{0, 0, 0, p.X, p.Y, 1, -q.Y * p.X, -q.Y * p.Y})
+		b = append(b, q.X, q.Y)
+	}
+	v, err := leastSquares(a, b)
+	if err != nil {
+		return Homography{}, fmt.Errorf("failed to fit a projective transformation (%w)", err)
+	}
+	var hn Homography
+	copy(hn[:], v)
+	hn[8] = 1
+
+	// Undo the normalization.
+	ndInv, err := nd.Inverse()
+	if err != nil {
+		return Homography{}, fmt.Errorf("failed to fit a projective transformation (%w)", err)
+	}
+	return ns.Homography().Then(hn).Then(ndInv.Homography()), nil
+}
+
+// Transform applies a transformation to every point in a mesh.  If pinEdges
+// is true, points on the mesh's outer rows and columns are left unchanged so
+// that they remain on the image boundary, as libmorph requires.  In
+// symmetric-editing mode, the transformed points are then symmetrized (see
+// EnableSymmetry).
+func (m *Mesh) Transform(t Transform, pinEdges bool) {
+	pts := m.Points()
+	mv := make([][]bool, len(pts))
+	for r, row := range pts {
+		mv[r] = make([]bool, len(row))
+		for c, pt := range row {
+			if pinEdges && (r == 0 || c == 0 || r == m.NY-1 || c == m.NX-1) {
+				continue
+			}
+			mv[r][c] = true
+			row[c] = t.Apply(pt)
+		}
+	}
+	if m.sym != nil {
+		m.symmetrize(pts, mv, func(r, c int, p Point) bool {
+			pts[r][c] = p
+			return true
+		})
+	}
+	m.BeginTransaction()
+	defer m.EndTransaction()
+	for r, row := range pts {
+		for c, pt := range row {
+			if mv[r][c] {
+				m.setRecorded(c, r, pt)
+			}
+		}
+	}
+}
@@ -0,0 +1,180 @@
+// The functions defined in this file ensure the xmorph package's
+// transformation operations work as expected.
+
+package xmorph
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// TestAffineBasics ensures that the basic affine constructors behave as
+// expected.
+func TestAffineBasics(t *testing.T) {
+	c := Point{X: 10, Y: 20}
+	tests := []struct {
+		a       Affine
+		in, out Point
+	}{
+		{IdentityAffine(), Point{3, 4}, Point{3, 4}},
+		{NewTranslation(5, -2), Point{3, 4}, Point{8, 2}},
+		{NewScaling(2, 3, c), Point{11, 21}, Point{12, 23}},
+		{NewRotation(math.Pi/2, c), Point{11, 20}, Point{10, 21}},
+		{NewShear(0.5, 0, c), Point{10, 24}, Point{12, 24}},
+	}
+	for i, tst := range tests {
+		if p := tst.a.Apply(tst.in); !p.Eq(tst.out, 1e-9) {
+			t.Fatalf("test %d: expected %v to map to %v but saw %v", i, tst.in, tst.out, p)
+		}
+	}
+}
+
+// TestAffineComposeInvert ensures that affine composition and inversion are
+// consistent with applying transformations one at a time.
+func TestAffineComposeInvert(t *testing.T) {
+	c := Point{X: 50, Y: 40}
+	a := NewRotation(0.3, c)
+	b := NewScaling(1.5, 0.75, Point{}).Then(NewTranslation(3, 4))
+	ab := a.Then(b)
+	abInv, err := ab.Inverse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rng := rand.New(rand.NewSource(31))
+	for i := 0; i < 100; i++ {
+		p := Point{X: rng.Float64() * 100, Y: rng.Float64() * 100}
+		q := ab.Apply(p)
+		if exp := b.Apply(a.Apply(p)); !q.Eq(exp, 1e-9) {
+			t.Fatalf("expected %v to map to %v but saw %v", p, exp, q)
+		}
+		if r := abInv.Apply(q); !r.Eq(p, 1e-9) {
+			t.Fatalf("expected the inverse to map %v back to %v but saw %v", q, p, r)
+		}
+		if r := ab.Homography().Apply(p); !r.Eq(q, 1e-9) {
+			t.Fatalf("expected the homography to map %v to %v but saw %v", p, q, r)
+		}
+	}
+	if _, err = NewScaling(0, 1, c).Inverse(); err == nil {
+		t.Fatal("expected inverting a singular Affine to fail")
+	}
+}
+
+// TestHomographyComposeInvert ensures that homography composition and
+// inversion are consistent with applying transformations one at a time.
+func TestHomographyComposeInvert(t *testing.T) {
+	h := Homography{1.1, 0.2, 5, -0.1, 0.9, 3, 0.001, 0.002, 1}
+	g := Homography{0.8, 0, -4, 0.1, 1.2, 7, -0.0005, 0.001, 1}
+	hg := h.Then(g)
+	hInv, err := h.Inverse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rng := rand.New(rand.NewSource(32))
+	for i := 0; i < 100; i++ {
+		p := Point{X: rng.Float64() * 100, Y: rng.Float64() * 100}
+		if q, exp := hg.Apply(p), g.Apply(h.Apply(p)); !q.Eq(exp, 1e-9) {
+			t.Fatalf("expected %v to map to %v but saw %v", p, exp, q)
+		}
+		if r := hInv.Apply(h.Apply(p)); !r.Eq(p, 1e-9) {
+			t.Fatalf("expected the inverse to map back to %v but saw %v", p, r)
+		}
+	}
+}
+
+// TestFitTransforms ensures that affine and projective transformations can be
+// recovered from point pairs.
+func TestFitTransforms(t *testing.T) {
+	rng := rand.New(rand.NewSource(33))
+	src := make([]Point, 12)
+	for i := range src {
+		src[i] = Point{X: rng.Float64() * 200, Y: rng.Float64() * 100}
+	}
+
+	// Fit an affine transformation.
+	a := NewRotation(-0.2, Point{X: 30, Y: 30}).Then(NewShear(0.1, 0.05, Point{}))
+	dst := make([]Point, len(src))
+	for i, p := range src {
+		dst[i] = a.Apply(p)
+	}
+	af, err := FitAffine(src, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range a {
+		if math.Abs(af[i]-a[i]) > 1e-6 {
+			t.Fatalf("expected %v but fit %v", a, af)
+		}
+	}
+
+	// Fit a projective transformation.
+	h := Homography{0.9, 0.1, 12, -0.05, 1.1, -7, 0.0008, -0.0004, 1}
+	for i, p := range src {
+		dst[i] = h.Apply(p)
+	}
+	hf, err := FitHomography(src[:4], dst[:4])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, p := range src {
+		if q := hf.Apply(p); !q.Eq(dst[i], 1e-6) {
+			t.Fatalf("expected %v to map to %v but saw %v", p, dst[i], q)
+		}
+	}
+	if _, err = FitHomography(src[:3], dst[:3]); err == nil {
+		t.Fatal("expected fitting a homography to 3 points to fail")
+	}
+}
+
+// TestFitSimilarity ensures that a similarity transformation can be recovered
+// from point pairs.
+func TestFitSimilarity(t *testing.T) {
+	rng := rand.New(rand.NewSource(40))
+	src := make([]Point, 10)
+	for i := range src {
+		src[i] = Point{X: rng.Float64() * 200, Y: rng.Float64() * 100}
+	}
+	a := NewRotation(0.7, Point{X: 50, Y: 40}).Then(NewScaling(0.6, 0.6, Point{X: 5, Y: 5})).Then(NewTranslation(13, -4))
+	dst := make([]Point, len(src))
+	for i, p := range src {
+		dst[i] = a.Apply(p)
+	}
+	for _, n := range []int{2, len(src)} {
+		af, err := FitSimilarity(src[:n], dst[:n])
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range a {
+			if math.Abs(af[i]-a[i]) > 1e-6 {
+				t.Fatalf("expected %v but fit %v", a, af)
+			}
+		}
+	}
+	if _, err := FitSimilarity(src[:1], dst[:1]); err == nil {
+		t.Fatal("expected fitting a similarity transformation to 1 point to fail")
+	}
+}
+
+// TestMeshTransform ensures that a mesh can be transformed with and without
+// pinned edges.
+func TestMeshTransform(t *testing.T) {
+	const nx, ny, wd, ht = 6, 5, 101, 81
+	a := NewTranslation(3, -2)
+	for _, pin := range []bool{false, true} {
+		m := NewRegularMesh(nx, ny, wd, ht)
+		orig := m.Points()
+		m.Transform(a, pin)
+		for r := 0; r < ny; r++ {
+			for c := 0; c < nx; c++ {
+				exp := a.Apply(orig[r][c])
+				if pin && (r == 0 || c == 0 || r == ny-1 || c == nx-1) {
+					exp = orig[r][c]
+				}
+				if pt := m.Get(c, r); !pt.Eq(exp, 1e-9) {
+					t.Fatalf("expected (%d, %d) = %v but saw %v", c, r, exp, pt)
+				}
+			}
+		}
+		m.Free()
+	}
+}
@@ -0,0 +1,113 @@
+// This file provides a function for checking a mesh for problems without
+// modifying it.
+
+package xmorph
+
+import (
+	"image"
+	"math"
+)
+
+// A MeshReport describes the problems that Mesh.Validate found in a mesh.
+// Cells are identified by the column and row of their upper-left mesh point;
+// points are identified by their column and row.
+type MeshReport struct {
+	InvertedCells []image.Point // Cells whose signed area is zero or negative
+	FoldedCells   []image.Point // Cells of positive area that are concave or self-intersecting
+	CrossedPoints []image.Point // Points at or left of their left neighbor or at or above their upper neighbor
+	OutsidePoints []image.Point // Points that lie outside the image
+	EdgePoints    []image.Point // Points on the mesh edge that do not lie on the image edge
+	MinCellArea   float64       // Smallest signed cell area
+	MinCell       image.Point   // Cell with the smallest signed area
+}
+
+// OK reports whether a MeshReport found no problems.
+func (r *MeshReport) OK() bool {
+	return len(r.InvertedCells) == 0 &&
+		len(r.FoldedCells) == 0 &&
+		len(r.CrossedPoints) == 0 &&
+		len(r.OutsidePoints) == 0 &&
+		len(r.EdgePoints) == 0
+}
+
+// cross returns the z component of the cross product of (b - a) and (c - b).
+func cross(a, b, c Point) float64 {
+	u, v := b.Sub(a), c.Sub(b)
+	return u.X*v.Y - u.Y*v.X
+}
+
+// segmentsIntersect reports whether segments pq and rs properly intersect.
+func segmentsIntersect(p, q, r, s Point) bool {
+	d1 := cross(p, q, r)
+	d2 := cross(p, q, s)
+	d3 := cross(r, s, p)
+	d4 := cross(r, s, q)
+	return d1*d2 < 0.0 && d3*d4 < 0.0
+}
+
+// cellArea returns the signed area of a quadrilateral whose vertices are
+// listed in clockwise screen order (i.e., with y increasing downwards).
+// Properly oriented cells have positive area.
+func cellArea(q [4]Point) float64 {
+	a := 0.0
+	for i := range q {
+		j := (i + 1) % 4
+		a += q[i].X*q[j].Y - q[j].X*q[i].Y
+	}
+	return a / 2.0
+}
+
+// Validate checks a mesh that corresponds to a w×h image for problems,
+// returning a report of everything it finds.  Unlike Functionalize, Validate
+// never modifies the mesh.
+func (m *Mesh) Validate(w, h int) *MeshReport {
+	pts := m.Points()
+	ny, nx := len(pts), len(pts[0])
+	rep := &MeshReport{MinCellArea: math.Inf(1)}
+	xMax, yMax := float64(w-1), float64(h-1)
+
+	// Check each point.
+	for r, row := range pts {
+		for c, pt := range row {
+			ip := image.Point{X: c, Y: r}
+			if pt.X < 0.0 || pt.Y < 0.0 || pt.X > xMax || pt.Y > yMax {
+				rep.OutsidePoints = append(rep.OutsidePoints, ip)
+			}
+			if (c == 0 && pt.X != 0.0) || (c == nx-1 && pt.X != xMax) ||
+				(r == 0 && pt.Y != 0.0) || (r == ny-1 && pt.Y != yMax) {
+				rep.EdgePoints = append(rep.EdgePoints, ip)
+			}
+			if (c > 0 && pt.X <= row[c-1].X) || (r > 0 && pt.Y <= pts[r-1][c].Y) {
+				rep.CrossedPoints = append(rep.CrossedPoints, ip)
+			}
+		}
+	}
+
+	// Check each cell.
+	for r := 0; r < ny-1; r++ {
+		for c := 0; c < nx-1; c++ {
+			ip := image.Point{X: c, Y: r}
+			q := [4]Point{pts[r][c], pts[r][c+1], pts[r+1][c+1], pts[r+1][c]}
+			area := cellArea(q)
+			if area < rep.MinCellArea {
+				rep.MinCellArea = area
+				rep.MinCell = ip
+			}
+			if area <= 0.0 {
+				rep.InvertedCells = append(rep.InvertedCells, ip)
+				continue
+			}
+			folded := segmentsIntersect(q[0], q[1], q[2], q[3]) ||
+				segmentsIntersect(q[1], q[2], q[3], q[0])
+			for i := range q {
+				if cross(q[i], q[(i+1)%4], q[(i+2)%4]) <= 0.0 {
+					folded = true
+				}
+			}
+			if folded {
+				rep.FoldedCells = append(rep.FoldedCells, ip)
+			}
+		}
+	}
+	return rep
+}
@@ -0,0 +1,76 @@
+// The functions defined in this file ensure the xmorph package's validation
+// operations work as expected.
+
+package xmorph
+
+import (
+	"image"
+	"testing"
+)
+
+// comparePointLists aborts if a list of mesh indices differs from what was
+// expected.
+func comparePointLists(t *testing.T, what string, actual, expected []image.Point) {
+	if len(actual) != len(expected) {
+		t.Fatalf("expected %s %v but saw %v", what, expected, actual)
+	}
+	for i := range actual {
+		if actual[i] != expected[i] {
+			t.Fatalf("expected %s %v but saw %v", what, expected, actual)
+		}
+	}
+}
+
+// TestValidateRegular ensures that a regular mesh passes validation.
+func TestValidateRegular(t *testing.T) {
+	const nx, ny, wd, ht = 7, 5, 61, 41
+	m := NewRegularMesh(nx, ny, wd, ht)
+	defer m.Free()
+	rep := m.Validate(wd, ht)
+	if !rep.OK() {
+		t.Fatalf("unexpected problems in a regular mesh: %+v", rep)
+	}
+	if rep.MinCellArea != 100.0 {
+		t.Fatalf("expected a minimum cell area of 100 but saw %v", rep.MinCellArea)
+	}
+}
+
+// TestValidateProblems ensures that Validate detects various problems without
+// modifying the mesh.
+func TestValidateProblems(t *testing.T) {
+	const nx, ny, wd, ht = 5, 5, 41, 41
+	m := NewRegularMesh(nx, ny, wd, ht)
+	defer m.Free()
+
+	// Push point (2, 1) past its right neighbor, folding the cells
+	// around it.
+	m.Set(2, 1, Point{X: 35, Y: 10})
+
+	// Move an edge point off the boundary and outside the image.
+	m.Set(4, 3, Point{X: 45, Y: 30})
+
+	// Validate the mesh.
+	before := m.Points()
+	rep := m.Validate(wd, ht)
+	comparePointSlices(t, before, m.Points())
+	if rep.OK() {
+		t.Fatal("expected problems to be found")
+	}
+	comparePointLists(t, "crossed points", rep.CrossedPoints, []image.Point{{3, 1}})
+	comparePointLists(t, "outside points", rep.OutsidePoints, []image.Point{{4, 3}})
+	comparePointLists(t, "edge points", rep.EdgePoints, []image.Point{{4, 3}})
+	comparePointLists(t, "inverted cells", rep.InvertedCells, nil)
+	comparePointLists(t, "folded cells", rep.FoldedCells, []image.Point{{2, 0}, {2, 1}})
+
+	// Mirror cell (1, 1) horizontally to invert it.
+	m = NewRegularMesh(nx, ny, wd, ht)
+	defer m.Free()
+	m.Set(2, 1, Point{X: 5, Y: 10})
+	m.Set(2, 2, Point{X: 5, Y: 20})
+	rep = m.Validate(wd, ht)
+	comparePointLists(t, "inverted cells", rep.InvertedCells, []image.Point{{1, 1}})
+	if rep.MinCell != (image.Point{X: 1, Y: 1}) || rep.MinCellArea != -50.0 {
+		t.Fatalf("expected cell (1, 1) to have area -50 but saw %v at %v",
+			rep.MinCellArea, rep.MinCell)
+	}
+}
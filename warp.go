@@ -93,9 +93,8 @@ func warpGray(img *image.Gray, src, dst *Mesh) *image.Gray {
 	}
 }
 
-// warpAny warps any image type by first converting it to NRGBA and then
-// invoking warpNRGBA.
-func warpAny(img image.Image, src, dst *Mesh) *image.NRGBA {
+// convertToNRGBA converts any image type to NRGBA.
+func convertToNRGBA(img image.Image) *image.NRGBA {
 	bnds := img.Bounds()
 	nrgba := image.NewNRGBA(bnds)
 	cm := nrgba.ColorModel()
@@ -105,7 +104,13 @@ func warpAny(img image.Image, src, dst *Mesh) *image.NRGBA {
 			nrgba.Set(x, y, cm.Convert(c))
 		}
 	}
-	return warpNRGBA(nrgba, src, dst)
+	return nrgba
+}
+
+// warpAny warps any image type by first converting it to NRGBA and then
+// invoking warpNRGBA.
+func warpAny(img image.Image, src, dst *Mesh) *image.NRGBA {
+	return warpNRGBA(convertToNRGBA(img), src, dst)
 }
 
 // warpCompletely distorts an image by warping an input mesh to an output mesh.